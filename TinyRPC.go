@@ -9,22 +9,30 @@ import (
 	"log"
 )
 
-// NewServer 创建服务端
-func NewServer(addr string) *server.Server {
+// NewServer 创建服务端，调用Shutdown/Close关闭，地址解析或绑定失败时返回错误
+// opts为reactor拓扑配置（worker、handler、subReactor数量等），未传入时根据CPU核数使用默认值
+// 启动后reactor出错时只输出日志，需要处理该错误时使用server.Listen与server.Run
+func NewServer(addr string, opts ...*reactor.ReactorOptions) (*server.Server, error) {
 	s := server.New()
+	if err := s.Listen(addr, opts...); err != nil {
+		return nil, err
+	}
 	go func() {
-		if err := reactor.Reactor(addr, s); err != nil {
-			log.Fatalln(err)
+		if err := s.Run(); err != nil && err != server.ErrServerClosed {
+			log.Printf("rpc server: serve %s: %v", addr, err)
 		}
 	}()
-	return s
+	return s, nil
 }
 
 // ServerStartRegisterClient 服务端启动注册中心客户端实例，注册服务及发送心态
 // 请调用server.Register后再调用此方法，将会读取所注册的所用服务信息并发送
 // addr 服务器地址
 func ServerStartRegisterClient(addr string, s *server.Server) error {
-	c, err := NewClient(config.RegisterAddr)
+	c, err := NewClientWithOptions(config.RegisterAddr, &client.DialOptions{
+		ConnectTimeout:   config.RegisterDial,
+		HandshakeTimeout: config.RegisterDial,
+	})
 	if err != nil {
 		return err
 	}
@@ -51,9 +59,16 @@ func ServerStartRegisterClient(addr string, s *server.Server) error {
 	return nil
 }
 
-// NewClient 创建客户端
+// NewClient 创建客户端，addr以"unix://"开头时连接Unix域套接字
 func NewClient(addr string, opts ...*server.Option) (*client.Client, error) {
-	return client.Dial("tcp", addr, opts...)
+	protocol, address := client.ParseAddr(addr)
+	return client.Dial(protocol, address, opts...)
+}
+
+// NewClientWithOptions 创建客户端，dopts可以设置请求的默认超时时间等
+func NewClientWithOptions(addr string, dopts *client.DialOptions) (*client.Client, error) {
+	protocol, address := client.ParseAddr(addr)
+	return client.DialWithOptions(protocol, address, dopts)
 }
 
 // NewClientByBalance 基于负载均衡的方式创建客户端
@@ -61,8 +76,17 @@ func NewClientByBalance(mode register.SelectMode, opts ...*server.Option) (*regi
 	return register.Dial(mode, opts...)
 }
 
-// NewRegister 创建注册中心
-func NewRegister() {
-	s := NewServer(config.RegisterAddr)
+// NewClientByBalanceWithOptions 基于负载均衡的方式创建客户端，dopts用于连接每一个服务器
+func NewClientByBalanceWithOptions(mode register.SelectMode, dopts *client.DialOptions) (*register.BalanceClient, error) {
+	return register.DialWithOptions(mode, dopts)
+}
+
+// NewRegister 创建注册中心，监听config.RegisterAddr失败时返回错误
+func NewRegister() error {
+	s, err := NewServer(config.RegisterAddr)
+	if err != nil {
+		return err
+	}
 	register.NewRegister(s)
+	return nil
 }
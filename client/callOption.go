@@ -0,0 +1,36 @@
+package client
+
+import (
+	"TinyRPC/metadata"
+	"context"
+)
+
+// CallOption 请求选项
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	md metadata.MD // 随请求发送的元数据
+}
+
+// WithMetadata 随请求发送元数据，与ctx中的元数据合并，相同的key以md为准
+func WithMetadata(md metadata.MD) CallOption {
+	return func(o *callOptions) {
+		o.md = metadata.Join(o.md, md)
+	}
+}
+
+// ApplyCallOptions 将请求选项保存到ctx中，拦截器可以通过metadata.FromOutgoingContext获取
+func ApplyCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+	var o callOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(o.md) > 0 {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Join(md, o.md))
+	}
+	return ctx
+}
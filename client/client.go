@@ -2,14 +2,19 @@ package client
 
 import (
 	"TinyRPC/codec"
+	"TinyRPC/metadata"
 	"TinyRPC/network"
 	"TinyRPC/server"
+	"TinyRPC/status"
+	"context"
+	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Client 客户端相关信息
@@ -20,6 +25,10 @@ type Client struct {
 	mu      sync.Mutex       // 确保seq的并发安全
 	sending sync.Mutex       // 请求的报文必须逐个发送
 	closing bool             // 客户端关闭标识
+	timeout time.Duration    // 请求的默认超时时间，0表示不超时
+	addr    string           // 服务器地址
+
+	interceptors Interceptors // 客户端拦截器
 }
 
 // Call 请求相关信息
@@ -27,26 +36,122 @@ type Call struct {
 	serviceMethod string      // 请求服务信息
 	seq           uint64      // 请求序号
 	argv, reply   interface{} //参数
+	deadline      time.Time   // 请求截止时间，零值表示没有截止时间
+	metadata      metadata.MD // 随请求发送的元数据
 	Error         error       // 服务端返回的错误信息
 	done          chan *Call  // 通知请求的响应已收到
 }
 
+// DialOptions 创建客户端的配置
+type DialOptions struct {
+	Option           *server.Option      // 协商报文，为nil时使用DefaultOption
+	Timeout          time.Duration       // 请求的默认超时时间，CallContext传入的ctx没有截止时间时使用，0表示不超时
+	ConnectTimeout   time.Duration       // 建立连接的超时时间，0表示不超时（由系统决定）
+	HandshakeTimeout time.Duration       // 发送协商报文的超时时间，0表示不超时
+	KeepAlive        time.Duration       // TCP keepalive探测间隔，0使用默认值（15s），负数关闭keepalive
+	DisableNoDelay   bool                // 为true时开启Nagle算法，默认设置TCP_NODELAY
+	TLSConfig        *tls.Config         // 不为nil时使用TLS，ServerName为空时使用addr中的主机名，双向认证时设置Certificates
+	Credentials      CredentialsProvider // 不为nil时每次建立连接生成凭证，替换Option.Credentials
+}
+
+// TimeoutError 请求超时，超时的请求从pending中移除，之后收到的响应将被丢弃
+type TimeoutError struct {
+	ServiceMethod string // 请求服务信息
+	Seq           uint64 // 请求序号
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("rpc client: call %s (seq %d) timeout", e.ServiceMethod, e.Seq)
+}
+
+// Timeout 实现net.Error
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// Temporary 实现net.Error
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+// Unwrap 使errors.Is(err, context.DeadlineExceeded)成立
+func (e *TimeoutError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
 // DefaultOption 默认协商信息
 var DefaultOption = &server.Option{
 	CodecType: "gob",
 }
 
-// Dial 连接服务器+创建客户端
+// ParseAddr 解析带协议前缀的服务器地址，"unix:///run/app.sock"返回("unix", "/run/app.sock")
+// "tcp://host:port"返回("tcp", "host:port")，没有前缀时为TCP地址
+func ParseAddr(addr string) (protocol, address string) {
+	if i := strings.Index(addr, "://"); i > 0 {
+		return addr[:i], addr[i+3:]
+	}
+	return "tcp", addr
+}
+
+// Dial 连接服务器+创建客户端，protocol为"tcp"或"unix"，"unix"时addr为套接字文件路径
 func Dial(protocol, addr string, opts ...*server.Option) (client *Client, err error) {
-	conn, err := net.Dial(protocol, addr)
+	return DialWithOptions(protocol, addr, &DialOptions{Option: ParseOption(opts...)})
+}
+
+// DialWithOptions 连接服务器+创建客户端，dopts为nil时使用默认配置
+func DialWithOptions(protocol, addr string, dopts *DialOptions) (client *Client, err error) {
+	if dopts == nil {
+		dopts = &DialOptions{}
+	}
+	dialer := &net.Dialer{
+		Timeout:   dopts.ConnectTimeout,
+		KeepAlive: dopts.KeepAlive,
+	}
+	conn, err := dialer.Dial(protocol, addr)
 	if err != nil {
 		return
 	}
-	opt := ParseOption(opts...)
-	client, err = NewClient(conn, opt)
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		if err = tcpConn.SetNoDelay(!dopts.DisableNoDelay); err != nil {
+			_ = conn.Close()
+			return
+		}
+	}
+	if dopts.TLSConfig != nil {
+		if conn, err = tlsHandshake(conn, addr, dopts); err != nil {
+			return
+		}
+	}
+	client, err = newClient(conn, ParseOption(dopts.Option), dopts)
 	return
 }
 
+// 在连接上完成TLS握手，超过HandshakeTimeout返回错误
+func tlsHandshake(conn net.Conn, addr string, dopts *DialOptions) (net.Conn, error) {
+	config := dopts.TLSConfig
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	ctx := context.Background()
+	if dopts.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dopts.HandshakeTimeout)
+		defer cancel()
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
 func ParseOption(opts ...*server.Option) *server.Option {
 	if len(opts) == 0 || opts[0] == nil {
 		return DefaultOption
@@ -56,26 +161,53 @@ func ParseOption(opts ...*server.Option) *server.Option {
 
 // NewClient 创建客户端
 func NewClient(conn net.Conn, opt *server.Option) (client *Client, err error) {
+	return newClient(conn, opt, &DialOptions{})
+}
+
+func newClient(conn net.Conn, opt *server.Option, dopts *DialOptions) (client *Client, err error) {
 	f := codec.NewCodecFuncMap[opt.CodecType]
 	if f == nil {
 		err = fmt.Errorf("invalid codec type %s", opt.CodecType)
 		_ = conn.Close()
 		return
 	}
+	if dopts.Credentials != nil {
+		var cred *server.Credentials
+		if cred, err = dopts.Credentials.Credentials(); err != nil {
+			_ = conn.Close()
+			return
+		}
+		o := *opt // 不修改调用方的Option
+		o.Credentials = cred
+		opt = &o
+	}
 
 	client = &Client{
 		seq:     1,
 		pending: make(map[uint64]*Call),
+		timeout: dopts.Timeout,
+		addr:    conn.RemoteAddr().String(),
 	}
 	c := network.NewConnByConn(conn) // 自定义了数据包的格式
 
 	// 发送协商报文
 	client.sending.Lock()
 	defer client.sending.Unlock()
+	if dopts.HandshakeTimeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(dopts.HandshakeTimeout))
+	}
 	if err = json.NewEncoder(c).Encode(opt); err != nil {
 		_ = conn.Close()
 		return
 	}
+	if dopts.HandshakeTimeout > 0 {
+		_ = conn.SetDeadline(time.Time{})
+	}
+	// 协商报文之后的帧按协商的方式压缩
+	if err = c.SetCompression(opt.Compression, opt.CompressMinSize); err != nil {
+		_ = conn.Close()
+		return
+	}
 
 	client.c = f(c)
 	go client.receive()
@@ -83,19 +215,97 @@ func NewClient(conn net.Conn, opt *server.Option) (client *Client, err error) {
 }
 
 // Call 同步请求，调用异步请求并等到call.done通知
-func (c *Client) Call(serviceMethod string, argv, reply interface{}) (err error) {
-	call, err := c.Go(serviceMethod, argv, reply)
-	caller := <-call.done
-	return caller.Error
+func (c *Client) Call(serviceMethod string, argv, reply interface{}, opts ...CallOption) (err error) {
+	return c.CallContext(context.Background(), serviceMethod, argv, reply, opts...)
+}
+
+// CallContext 同步请求，ctx的截止时间通过header发送给服务端，服务端超过截止时间后取消请求的context
+// ctx没有截止时间时使用DialOptions.Timeout。超时返回*TimeoutError，ctx被取消返回ctx.Err()
+// ctx中的元数据（metadata.NewOutgoingContext）与opts设置的元数据随请求发送
+func (c *Client) CallContext(ctx context.Context, serviceMethod string, argv, reply interface{}, opts ...CallOption) (err error) {
+	ctx = ApplyCallOptions(ctx, opts...)
+	info := &CallInfo{ServiceMethod: serviceMethod, Addr: c.addr}
+	return c.interceptors.Invoker(info, func(ctx context.Context, info *CallInfo, argv, reply interface{}) error {
+		return c.invoke(ctx, info.ServiceMethod, argv, reply)
+	})(ctx, serviceMethod, argv, reply)
+}
+
+// Use 添加拦截器，拦截Call、CallContext、Go发起的请求，先添加的拦截器先执行
+func (c *Client) Use(interceptors ...UnaryClientInterceptor) {
+	c.interceptors.Use(interceptors...)
+}
+
+// 发送请求并等待响应，拦截器链的最后一环
+func (c *Client) invoke(ctx context.Context, serviceMethod string, argv, reply interface{}) (err error) {
+	if _, ok := ctx.Deadline(); !ok && c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	deadline, _ := ctx.Deadline()
+	md, _ := metadata.FromOutgoingContext(ctx)
+	call, err := c.goDeadline(deadline, md, serviceMethod, argv, reply)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case caller := <-call.done:
+		return caller.Error
+	case <-ctx.Done():
+		// 移除请求，之后收到的响应在receive中丢弃
+		c.mu.Lock()
+		delete(c.pending, call.seq)
+		c.mu.Unlock()
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return &TimeoutError{ServiceMethod: serviceMethod, Seq: call.seq}
+		}
+		return ctx.Err()
+	}
 }
 
-// Go 异步请求
+// Go 异步请求，通过call.Done()等待响应
+// 设置了拦截器时，请求在新的goroutine中经过拦截器发送，发送请求的错误通过call.Error返回
 func (c *Client) Go(serviceMethod string, argv, reply interface{}) (call *Call, err error) {
+	if len(c.interceptors.Load()) == 0 {
+		return c.goDeadline(time.Time{}, nil, serviceMethod, argv, reply)
+	}
+
+	return Async(serviceMethod, argv, reply, func() error {
+		return c.CallContext(context.Background(), serviceMethod, argv, reply)
+	}), nil
+}
+
+// Async 在新的goroutine中执行同步请求fn，fn返回后通过call.Done()通知，用于经过拦截器的异步请求
+func Async(serviceMethod string, argv, reply interface{}, fn func() error) *Call {
+	call := &Call{
+		serviceMethod: serviceMethod,
+		argv:          argv,
+		reply:         reply,
+		done:          make(chan *Call, 1),
+	}
+	go func() {
+		call.Error = fn()
+		call.done <- call
+	}()
+	return call
+}
+
+// Done 请求完成后返回call，Error为请求的错误信息
+func (call *Call) Done() <-chan *Call {
+	return call.done
+}
+
+func (c *Client) goDeadline(deadline time.Time, md metadata.MD, serviceMethod string, argv, reply interface{}) (call *Call, err error) {
 	call = &Call{
 		serviceMethod: serviceMethod,
 		argv:          argv,
 		reply:         reply,
-		done:          make(chan *Call),
+		deadline:      deadline,
+		metadata:      md,
+		done:          make(chan *Call, 1), // 带缓冲，请求超时后receive发送响应不会阻塞
 	}
 
 	c.mu.Lock()
@@ -116,14 +326,25 @@ func (c *Client) send(call *Call) (err error) {
 	c.mu.Lock()
 	if c.closing {
 		c.mu.Unlock()
-		err = errors.New("conn is closing")
+		err = status.New(status.Unavailable, "conn is closing")
 		return
 	}
 	c.pending[call.seq] = call
 	c.mu.Unlock()
 
-	if err = c.c.Writer(&codec.Header{ServiceMethod: call.serviceMethod, Seq: call.seq, Error: ""}, call.argv); err != nil {
+	header := &codec.Header{ServiceMethod: call.serviceMethod, Seq: call.seq, Error: "", Metadata: call.metadata}
+	if !call.deadline.IsZero() {
+		// 发送剩余的超时时间而不是截止时间，两端时钟不一致时截止时间会提前或推迟
+		header.Timeout = int64(time.Until(call.deadline))
+		if header.Timeout <= 0 {
+			header.Timeout = 1 // 已经超时，服务端收到后立即取消
+		}
+	}
+	if err = c.c.Writer(header, call.argv); err != nil {
 		log.Println("client send request error: ", err)
+		c.mu.Lock()
+		delete(c.pending, call.seq)
+		c.mu.Unlock()
 		return
 	}
 	return
@@ -146,24 +367,26 @@ func (c *Client) receive() {
 		delete(c.pending, header.Seq)
 		c.mu.Unlock()
 
+		// 服务端返回错误时不会发送body
 		switch {
-		case call == nil:
-			err = c.c.ReadBody(nil)
-			fmt.Println("call is nil", header)
+		case call == nil: // 请求已超时或取消，丢弃响应
+			if header.Error == "" {
+				err = c.c.ReadBody(nil)
+			}
 		case header.Error != "":
-			call.Error = fmt.Errorf(header.Error)
-			err = c.c.ReadBody(nil)
+			call.Error = headerError(&header)
+			call.done <- call
 		default:
 			err = c.c.ReadBody(call.reply)
 			if err != nil {
-				call.Error = errors.New("read body error: " + err.Error())
+				call.Error = status.New(status.Internal, "read body error: "+err.Error())
 			}
 			call.done <- call
 		}
 	}
 	c.mu.Lock()
 	for _, call := range c.pending {
-		call.Error = err
+		call.Error = status.New(status.Unavailable, "rpc client: connection lost: "+err.Error())
 		select {
 		case call.done <- call:
 			continue
@@ -175,6 +398,15 @@ func (c *Client) receive() {
 	c.Close()
 }
 
+// 根据header中的状态码还原服务端返回的错误，客户端可通过errors.As获取*status.Error
+func headerError(header *codec.Header) error {
+	code := status.Code(header.Code)
+	if code == status.OK { // 服务端未设置状态码
+		code = status.Unknown
+	}
+	return &status.Error{Code: code, Message: header.Error, Details: header.Details}
+}
+
 // Close 关闭连接
 func (c *Client) Close() {
 	c.mu.Lock()
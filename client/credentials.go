@@ -0,0 +1,45 @@
+package client
+
+import (
+	"TinyRPC/server"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// CredentialsProvider 每次建立连接时生成凭证，随协商报文发送
+type CredentialsProvider interface {
+	Credentials() (*server.Credentials, error)
+}
+
+// CredentialsFunc 函数形式的CredentialsProvider
+type CredentialsFunc func() (*server.Credentials, error)
+
+func (f CredentialsFunc) Credentials() (*server.Credentials, error) {
+	return f()
+}
+
+// TokenCredentials 使用固定的bearer token，对应server.TokenAuthenticator
+func TokenCredentials(token string) CredentialsProvider {
+	return CredentialsFunc(func() (*server.Credentials, error) {
+		return &server.Credentials{Token: token}, nil
+	})
+}
+
+// HMACCredentials 每次建立连接时生成新的nonce并签名，对应server.HMACAuthenticator
+func HMACCredentials(keyID string, key []byte) CredentialsProvider {
+	return CredentialsFunc(func() (*server.Credentials, error) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		nonce := hex.EncodeToString(b)
+		ts := time.Now().Unix()
+		return &server.Credentials{
+			KeyID:     keyID,
+			Nonce:     nonce,
+			Timestamp: ts,
+			Signature: server.SignHMAC(key, keyID, nonce, ts),
+		}, nil
+	})
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// CallInfo 拦截器获取的请求信息
+type CallInfo struct {
+	ServiceMethod string // 请求方法，格式为 Service.Method
+	Addr          string // 服务器地址，负载均衡客户端在每次调用invoker时重新选择，invoker返回后为本次选择的服务器地址
+}
+
+// Invoker 调用下一个拦截器，最后一个拦截器调用的是发送请求并等待响应
+type Invoker func(ctx context.Context, serviceMethod string, argv, reply interface{}) error
+
+// UnaryClientInterceptor 客户端拦截器，可用于注入元数据、重试、链路追踪、日志等
+// 调用invoker继续发送请求，返回值即为请求最终的错误
+type UnaryClientInterceptor func(ctx context.Context, info *CallInfo, argv, reply interface{}, invoker Invoker) error
+
+// Interceptors 客户端拦截器列表，写时复制，发送请求时读取不需要加锁
+type Interceptors struct {
+	list atomic.Value // []UnaryClientInterceptor
+	mu   sync.Mutex   // 保证Use串行修改拦截器列表
+}
+
+// Use 添加拦截器，先添加的拦截器先执行
+func (is *Interceptors) Use(interceptors ...UnaryClientInterceptor) {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+
+	old := is.Load()
+	chain := make([]UnaryClientInterceptor, 0, len(old)+len(interceptors))
+	chain = append(chain, old...)
+	chain = append(chain, interceptors...)
+	is.list.Store(chain)
+}
+
+// Load 返回当前的拦截器列表
+func (is *Interceptors) Load() []UnaryClientInterceptor {
+	list, _ := is.list.Load().([]UnaryClientInterceptor)
+	return list
+}
+
+// Invoker 将拦截器与最终的调用组合成一个Invoker
+// 拦截器调用invoker时修改了serviceMethod，之后的拦截器及final收到的是ServiceMethod为新值的info副本，
+// final对副本的修改（如负载均衡客户端设置Addr）在invoker返回后同步给之前的拦截器
+func (is *Interceptors) Invoker(info *CallInfo, final func(ctx context.Context, info *CallInfo, argv, reply interface{}) error) Invoker {
+	interceptors := is.Load()
+	invoke := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoke
+		invoke = func(ctx context.Context, info *CallInfo, argv, reply interface{}) error {
+			return interceptor(ctx, info, argv, reply, func(ctx context.Context, serviceMethod string, argv, reply interface{}) error {
+				return forward(ctx, info, serviceMethod, argv, reply, next)
+			})
+		}
+	}
+	return func(ctx context.Context, serviceMethod string, argv, reply interface{}) error {
+		return forward(ctx, info, serviceMethod, argv, reply, invoke)
+	}
+}
+
+// 使用serviceMethod调用next，与info.ServiceMethod不同时传入副本，返回后将Addr同步回info
+func forward(ctx context.Context, info *CallInfo, serviceMethod string, argv, reply interface{}, next func(context.Context, *CallInfo, interface{}, interface{}) error) error {
+	if serviceMethod == info.ServiceMethod {
+		return next(ctx, info, argv, reply)
+	}
+	ci := *info
+	ci.ServiceMethod = serviceMethod
+	err := next(ctx, &ci, argv, reply)
+	info.Addr = ci.Addr
+	return err
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// 拦截器按添加顺序执行，修改serviceMethod后之后的拦截器及final收到新的方法名
+func TestInterceptorsRewriteServiceMethod(t *testing.T) {
+	var is Interceptors
+	var seen []string
+	record := func(name string) UnaryClientInterceptor {
+		return func(ctx context.Context, info *CallInfo, argv, reply interface{}, invoker Invoker) error {
+			seen = append(seen, name+":"+info.ServiceMethod)
+			err := invoker(ctx, info.ServiceMethod, argv, reply)
+			seen = append(seen, name+" addr:"+info.Addr)
+			return err
+		}
+	}
+	is.Use(record("a"), func(ctx context.Context, info *CallInfo, argv, reply interface{}, invoker Invoker) error {
+		return invoker(ctx, "Arith.Mul", argv, reply)
+	}, record("b"))
+
+	info := &CallInfo{ServiceMethod: "Arith.Add"}
+	err := is.Invoker(info, func(ctx context.Context, info *CallInfo, argv, reply interface{}) error {
+		seen = append(seen, "final:"+info.ServiceMethod)
+		info.Addr = "127.0.0.1:8080"
+		return nil
+	})(context.Background(), info.ServiceMethod, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a:Arith.Add", "b:Arith.Mul", "final:Arith.Mul", "b addr:127.0.0.1:8080", "a addr:127.0.0.1:8080"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("seen %v, want %v", seen, want)
+	}
+	if info.ServiceMethod != "Arith.Add" {
+		t.Fatalf("caller's info.ServiceMethod = %q, want unchanged", info.ServiceMethod)
+	}
+}
+
+// 没有拦截器时直接调用final，调用方传入的serviceMethod同样生效
+func TestInterceptorsEmpty(t *testing.T) {
+	var is Interceptors
+	info := &CallInfo{ServiceMethod: "Arith.Add"}
+	var got string
+	_ = is.Invoker(info, func(ctx context.Context, info *CallInfo, argv, reply interface{}) error {
+		got = info.ServiceMethod
+		return nil
+	})(context.Background(), "Arith.Div", nil, nil)
+	if got != "Arith.Div" {
+		t.Fatalf("final got %q, want Arith.Div", got)
+	}
+}
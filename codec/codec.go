@@ -1,11 +1,18 @@
 package codec
 
-import "io"
+import (
+	"bytes"
+	"io"
+)
 
 type Header struct {
-	ServiceMethod string // 请求方法
-	Seq           uint64 // 请求编号，客户端异步请求时的标识
-	Error         string // 服务端错误通过header传回
+	ServiceMethod string            // 请求方法
+	Seq           uint64            // 请求编号，客户端异步请求时的标识
+	Error         string            // 服务端错误通过header传回
+	Code          uint32            // 错误的状态码，见status.Code
+	Details       []byte            // 错误详情，见status.Error
+	Timeout       int64             // 请求剩余的超时时间（纳秒），0表示没有超时，服务端收到请求时按本地时钟计算截止时间，不受两端时钟偏差影响
+	Metadata      map[string]string // 请求元数据，如鉴权token、trace ID、租户ID，服务端通过metadata.FromIncomingContext获取
 }
 
 // Codec 序列化器 要实现的接口
@@ -16,6 +23,47 @@ type Codec interface {
 	Writer(*Header, interface{}) error
 }
 
+// FrameWriter 区分header和body发送一个报文，接收方在读取body之前即可检查两者的长度
+type FrameWriter interface {
+	WriteFrame(header, body []byte) (int, error)
+}
+
+// FrameLimiter 提供接收的header和body最大长度，自行分帧的序列化器按该限制检查报文长度
+type FrameLimiter interface {
+	Limits() (maxHeader, maxBody int)
+}
+
+// 发送一个报文，b的前headerLen字节为header，conn不支持FrameWriter时整个报文一次Write
+func writeMessage(conn io.Writer, b []byte, headerLen int) (err error) {
+	if fw, ok := conn.(FrameWriter); ok {
+		_, err = fw.WriteFrame(b[:headerLen], b[headerLen:])
+	} else {
+		_, err = conn.Write(b)
+	}
+	return
+}
+
+// 流式编码器，如gob、json、msgpack的Encoder
+type encoder interface {
+	Encode(interface{}) error
+}
+
+// 将header和body依次编码到buf后作为一个报文发送，buf为enc的输出
+// 一个报文只调用一次conn.Write，保证报文完整地在同一帧中发送
+func encodeMessage(conn io.Writer, buf *bytes.Buffer, enc encoder, header *Header, body interface{}) error {
+	defer buf.Reset()
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	headerLen := buf.Len()
+	if body != nil {
+		if err := enc.Encode(body); err != nil {
+			return err
+		}
+	}
+	return writeMessage(conn, buf.Bytes(), headerLen)
+}
+
 type Type string
 type NewCodecFunc func(io.ReadWriteCloser) Codec
 
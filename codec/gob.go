@@ -1,7 +1,7 @@
 package codec
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/gob"
 	"io"
 )
@@ -10,7 +10,7 @@ import (
 
 type GobCodec struct {
 	conn io.ReadWriteCloser
-	buf  *bufio.Writer // 写入缓冲区，防止阻塞。Writer 的接口是指针类型的接口
+	buf  *bytes.Buffer // 写入缓冲区，一个报文编码完成后一次发送
 	dec  *gob.Decoder  // Decoder 的接口是指针类型的接口
 	enc  *gob.Encoder  // Encoder 的接口是指针类型的接口
 }
@@ -27,29 +27,14 @@ func (g *GobCodec) ReadBody(body interface{}) error {
 	return g.dec.Decode(body)
 }
 
-func (g *GobCodec) Writer(header *Header, body interface{}) (err error) {
-	defer func() {
-		e := g.buf.Flush()
-		if err == nil {
-			err = e
-		}
-	}()
-
-	if err = g.enc.Encode(header); err != nil {
-		return
-	}
-	if body != nil {
-		if err = g.enc.Encode(body); err != nil {
-			return
-		}
-	}
-	return
+func (g *GobCodec) Writer(header *Header, body interface{}) error {
+	return encodeMessage(g.conn, g.buf, g.enc, header, body)
 }
 
 var _ Codec = (*GobCodec)(nil)
 
 func NewGobCodec(conn io.ReadWriteCloser) Codec {
-	buf := bufio.NewWriter(conn)
+	buf := new(bytes.Buffer)
 	return &GobCodec{
 		conn: conn,
 		buf:  buf,
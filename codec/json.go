@@ -1,7 +1,7 @@
 package codec
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/json"
 	"io"
 )
@@ -10,7 +10,7 @@ import (
 
 type JsonCodec struct {
 	conn io.ReadWriteCloser
-	buf  *bufio.Writer
+	buf  *bytes.Buffer
 	dec  *json.Decoder
 	enc  *json.Encoder
 }
@@ -24,32 +24,21 @@ func (j *JsonCodec) ReadHeader(header *Header) error {
 }
 
 func (j *JsonCodec) ReadBody(body interface{}) error {
+	if body == nil { // 丢弃body
+		var discard json.RawMessage
+		return j.dec.Decode(&discard)
+	}
 	return j.dec.Decode(body)
 }
 
-func (j *JsonCodec) Writer(header *Header, body interface{}) (err error) {
-	defer func() {
-		e := j.buf.Flush()
-		if err == nil {
-			err = e
-		}
-	}()
-
-	if err = j.enc.Encode(header); err != nil {
-		return
-	}
-	if body != nil {
-		if err = j.enc.Encode(body); err != nil {
-			return
-		}
-	}
-	return
+func (j *JsonCodec) Writer(header *Header, body interface{}) error {
+	return encodeMessage(j.conn, j.buf, j.enc, header, body)
 }
 
 var _ Codec = (*JsonCodec)(nil)
 
 func NewJsonCodec(conn io.ReadWriteCloser) Codec {
-	buf := bufio.NewWriter(conn)
+	buf := new(bytes.Buffer)
 	return &JsonCodec{
 		conn: conn,
 		buf:  buf,
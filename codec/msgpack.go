@@ -0,0 +1,53 @@
+package codec
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpack 无需预先定义schema的二进制序列化方式，便于其他语言的客户端接入
+// Header按字段名编码为map
+
+type MsgpackCodec struct {
+	conn io.ReadWriteCloser
+	buf  *bytes.Buffer
+	dec  *msgpack.Decoder
+	enc  *msgpack.Encoder
+}
+
+func (m *MsgpackCodec) Close() error {
+	return m.conn.Close()
+}
+
+func (m *MsgpackCodec) ReadHeader(header *Header) error {
+	return m.dec.Decode(header)
+}
+
+func (m *MsgpackCodec) ReadBody(body interface{}) error {
+	if body == nil { // 丢弃body
+		return m.dec.Skip()
+	}
+	return m.dec.Decode(body)
+}
+
+func (m *MsgpackCodec) Writer(header *Header, body interface{}) error {
+	return encodeMessage(m.conn, m.buf, m.enc, header, body)
+}
+
+var _ Codec = (*MsgpackCodec)(nil)
+
+func NewMsgpackCodec(conn io.ReadWriteCloser) Codec {
+	buf := new(bytes.Buffer)
+	return &MsgpackCodec{
+		conn: conn,
+		buf:  buf,
+		dec:  msgpack.NewDecoder(conn),
+		enc:  msgpack.NewEncoder(buf),
+	}
+}
+
+func init() {
+	Register("msgpack", NewMsgpackCodec)
+}
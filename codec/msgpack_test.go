@@ -0,0 +1,88 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+)
+
+type msgpackArgs struct {
+	A, B int
+	Name string
+	Tags []string
+}
+
+// 记录WriteFrame收到的header和body
+type frameConn struct {
+	*bufConn
+	headers, bodies [][]byte
+}
+
+func (f *frameConn) WriteFrame(header, body []byte) (int, error) {
+	f.headers = append(f.headers, append([]byte(nil), header...))
+	f.bodies = append(f.bodies, append([]byte(nil), body...))
+	f.Write(header)
+	return f.Write(body)
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	conn := &frameConn{bufConn: &bufConn{}}
+	c := NewMsgpackCodec(conn)
+
+	want := Header{
+		ServiceMethod: "Arith.Add",
+		Seq:           7,
+		Error:         "bad args",
+		Code:          3,
+		Details:       []byte{1, 2, 3},
+		Timeout:       1500000000,
+		Metadata:      map[string]string{"token": "t1", "trace-id": "abc"},
+	}
+	args := msgpackArgs{A: 1, B: -2, Name: "add", Tags: []string{"x", "y"}}
+	if err := c.Writer(&want, &args); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Writer(&Header{ServiceMethod: "Arith.Mul", Seq: 8}, 42); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Writer(&Header{Seq: 9}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.headers) != 3 || len(conn.bodies[2]) != 0 {
+		t.Fatalf("%d frames, last body %d bytes", len(conn.headers), len(conn.bodies[2]))
+	}
+
+	var h Header
+	if err := c.ReadHeader(&h); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Fatalf("header = %+v, want %+v", h, want)
+	}
+	var got msgpackArgs
+	if err := c.ReadBody(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, args) {
+		t.Fatalf("body = %+v, want %+v", got, args)
+	}
+
+	// 丢弃body后继续读取下一个报文
+	h = Header{}
+	if err := c.ReadHeader(&h); err != nil {
+		t.Fatal(err)
+	}
+	if h.ServiceMethod != "Arith.Mul" || h.Seq != 8 {
+		t.Fatalf("header = %+v", h)
+	}
+	if err := c.ReadBody(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	h = Header{}
+	if err := c.ReadHeader(&h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Seq != 9 {
+		t.Fatalf("header = %+v", h)
+	}
+}
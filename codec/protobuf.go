@@ -0,0 +1,262 @@
+package codec
+
+import (
+	"TinyRPC/network"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// protobuf 报文格式：| 报文长度(uvarint) | header长度(uvarint) | header | body |
+// header使用protowire按字段编码，body为proto.Message
+// 只有完整收到一个报文后ReadHeader才会返回，非阻塞读取返回EAGAIN时保留已读取的数据，下次继续读取
+
+var errNotProtoMessage = errors.New("rpc codec: protobuf body must implement proto.Message")
+
+// header字段编号
+const (
+	pbServiceMethod protowire.Number = iota + 1
+	pbSeq
+	pbError
+	pbCode
+	pbDetails
+	pbTimeout
+	pbMetadata
+)
+
+// metadata键值对字段编号
+const (
+	pbMetadataKey protowire.Number = iota + 1
+	pbMetadataValue
+)
+
+type ProtobufCodec struct {
+	conn io.ReadWriteCloser
+	rbuf []byte // 已读取但还未解析的数据
+	body []byte // ReadHeader解析出的body，等待ReadBody
+}
+
+func (p *ProtobufCodec) Close() error {
+	return p.conn.Close()
+}
+
+func (p *ProtobufCodec) ReadHeader(header *Header) error {
+	frame, err := p.readFrame()
+	if err != nil {
+		return err
+	}
+
+	headLen, n := protowire.ConsumeVarint(frame)
+	if n < 0 || headLen > uint64(len(frame)-n) {
+		return errors.New("rpc codec: protobuf invalid header length")
+	}
+	frame = frame[n:]
+	if maxHeader, maxBody := p.limits(); headLen > uint64(maxHeader) || uint64(len(frame))-headLen > uint64(maxBody) {
+		return network.ErrFrameTooLarge
+	}
+	p.body = frame[headLen:] // 上一个报文未调用ReadBody时直接丢弃
+	return unmarshalHeader(frame[:headLen], header)
+}
+
+func (p *ProtobufCodec) ReadBody(body interface{}) error {
+	b := p.body
+	p.body = nil
+	if body == nil { // 丢弃body
+		return nil
+	}
+	m, ok := body.(proto.Message)
+	if !ok {
+		return errNotProtoMessage
+	}
+	return proto.Unmarshal(b, m)
+}
+
+func (p *ProtobufCodec) Writer(header *Header, body interface{}) (err error) {
+	var b []byte
+	if body != nil {
+		m, ok := body.(proto.Message)
+		if !ok {
+			return errNotProtoMessage
+		}
+		if b, err = proto.Marshal(m); err != nil {
+			return
+		}
+	}
+
+	h := marshalHeader(header)
+	frame := make([]byte, 0, 2*binary.MaxVarintLen64+len(h)+len(b))
+	frame = protowire.AppendVarint(frame, uint64(protowire.SizeVarint(uint64(len(h)))+len(h)+len(b)))
+	frame = protowire.AppendVarint(frame, uint64(len(h)))
+	frame = append(frame, h...)
+	frame = append(frame, b...)
+	return writeMessage(p.conn, frame, len(frame)-len(b)) // 一个报文只调用一次Write
+}
+
+// 接收报文的长度限制，conn实现FrameLimiter时使用连接配置的限制，否则使用默认值
+func (p *ProtobufCodec) limits() (maxHeader, maxBody int) {
+	if l, ok := p.conn.(FrameLimiter); ok {
+		return l.Limits()
+	}
+	return network.DefaultMaxHeaderSize, network.DefaultMaxBodySize
+}
+
+// 读取一个完整的报文，数据不足时继续从conn读取，conn返回错误时已读取的数据保留在rbuf中
+// 报文长度在分配缓冲区之前按limits检查，防止错误的长度导致分配过大的内存
+func (p *ProtobufCodec) readFrame() ([]byte, error) {
+	for {
+		if length, n := protowire.ConsumeVarint(p.rbuf); n > 0 {
+			if maxHeader, maxBody := p.limits(); length > uint64(binary.MaxVarintLen64+maxHeader+maxBody) {
+				return nil, network.ErrFrameTooLarge
+			}
+			if total := n + int(length); len(p.rbuf) >= total {
+				frame := p.rbuf[n:total:total]
+				p.rbuf = p.rbuf[total:]
+				return frame, nil
+			}
+		} else if n != -1 && len(p.rbuf) >= binary.MaxVarintLen64 { // n == -1 表示数据不足
+			return nil, errors.New("rpc codec: protobuf invalid frame length")
+		}
+
+		if cap(p.rbuf)-len(p.rbuf) < 4096 {
+			rbuf := make([]byte, len(p.rbuf), 2*cap(p.rbuf)+4096)
+			copy(rbuf, p.rbuf)
+			p.rbuf = rbuf
+		}
+		n, err := p.conn.Read(p.rbuf[len(p.rbuf):cap(p.rbuf)])
+		if n > 0 {
+			p.rbuf = p.rbuf[:len(p.rbuf)+n]
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func marshalHeader(h *Header) []byte {
+	var b []byte
+	if h.ServiceMethod != "" {
+		b = protowire.AppendTag(b, pbServiceMethod, protowire.BytesType)
+		b = protowire.AppendString(b, h.ServiceMethod)
+	}
+	if h.Seq != 0 {
+		b = protowire.AppendTag(b, pbSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, h.Seq)
+	}
+	if h.Error != "" {
+		b = protowire.AppendTag(b, pbError, protowire.BytesType)
+		b = protowire.AppendString(b, h.Error)
+	}
+	if h.Code != 0 {
+		b = protowire.AppendTag(b, pbCode, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(h.Code))
+	}
+	if len(h.Details) > 0 {
+		b = protowire.AppendTag(b, pbDetails, protowire.BytesType)
+		b = protowire.AppendBytes(b, h.Details)
+	}
+	if h.Timeout != 0 {
+		b = protowire.AppendTag(b, pbTimeout, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(h.Timeout))
+	}
+	for k, v := range h.Metadata {
+		var entry []byte
+		entry = protowire.AppendTag(entry, pbMetadataKey, protowire.BytesType)
+		entry = protowire.AppendString(entry, k)
+		entry = protowire.AppendTag(entry, pbMetadataValue, protowire.BytesType)
+		entry = protowire.AppendString(entry, v)
+		b = protowire.AppendTag(b, pbMetadata, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return b
+}
+
+func unmarshalHeader(b []byte, h *Header) error {
+	*h = Header{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == pbServiceMethod && typ == protowire.BytesType:
+			h.ServiceMethod, n = protowire.ConsumeString(b)
+		case num == pbSeq && typ == protowire.VarintType:
+			h.Seq, n = protowire.ConsumeVarint(b)
+		case num == pbError && typ == protowire.BytesType:
+			h.Error, n = protowire.ConsumeString(b)
+		case num == pbCode && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			h.Code = uint32(v)
+		case num == pbDetails && typ == protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			h.Details = append([]byte(nil), v...)
+		case num == pbTimeout && typ == protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			h.Timeout = int64(v)
+		case num == pbMetadata && typ == protowire.BytesType:
+			var entry []byte
+			if entry, n = protowire.ConsumeBytes(b); n >= 0 {
+				if err := unmarshalMetadata(entry, h); err != nil {
+					return err
+				}
+			}
+		default: // 忽略未知字段，兼容新增字段
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func unmarshalMetadata(b []byte, h *Header) error {
+	var key, value string
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == pbMetadataKey && typ == protowire.BytesType:
+			key, n = protowire.ConsumeString(b)
+		case num == pbMetadataValue && typ == protowire.BytesType:
+			value, n = protowire.ConsumeString(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+
+	if h.Metadata == nil {
+		h.Metadata = make(map[string]string)
+	}
+	h.Metadata[key] = value
+	return nil
+}
+
+var _ Codec = (*ProtobufCodec)(nil)
+
+func NewProtobufCodec(conn io.ReadWriteCloser) Codec {
+	return &ProtobufCodec{
+		conn: conn,
+	}
+}
+
+func init() {
+	Register("protobuf", NewProtobufCodec)
+}
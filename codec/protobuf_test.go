@@ -0,0 +1,109 @@
+package codec
+
+import (
+	"TinyRPC/network"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// 内存中的连接，limits不为nil时实现FrameLimiter
+type bufConn struct {
+	bytes.Buffer
+	limits []int
+}
+
+func (b *bufConn) Close() error { return nil }
+
+type limitedConn struct {
+	*bufConn
+}
+
+func (l limitedConn) Limits() (int, int) {
+	return l.limits[0], l.limits[1]
+}
+
+func TestProtobufHeaderRoundTrip(t *testing.T) {
+	for _, want := range []Header{
+		{ServiceMethod: "Arith.Add", Seq: 1},
+		{
+			ServiceMethod: "Arith.Div",
+			Seq:           1<<64 - 1,
+			Error:         "divide by zero",
+			Code:          3,
+			Details:       []byte{0, 1, 2, 0xff},
+			Timeout:       1500000000,
+			Metadata:      map[string]string{"token": "t1", "trace-id": "abc", "": "empty key", "empty": ""},
+		},
+	} {
+		conn := &bufConn{}
+		c := NewProtobufCodec(conn)
+		if err := c.Writer(&want, wrapperspb.String("hello")); err != nil {
+			t.Fatal(err)
+		}
+		// 上一个报文的字段不能残留到下一个报文
+		if err := c.Writer(&Header{Seq: 2}, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var got Header
+		if err := c.ReadHeader(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("header = %+v, want %+v", got, want)
+		}
+		var body wrapperspb.StringValue
+		if err := c.ReadBody(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Value != "hello" {
+			t.Fatalf("body = %q, want hello", body.Value)
+		}
+
+		if err := c.ReadHeader(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, Header{Seq: 2}) {
+			t.Fatalf("second header = %+v", got)
+		}
+	}
+}
+
+// 连接配置的header和body长度限制
+func TestProtobufLimits(t *testing.T) {
+	body := wrapperspb.Bytes(make([]byte, 100))
+	for _, tt := range []struct {
+		name      string
+		maxHeader int
+		maxBody   int
+		err       error
+	}{
+		{"within limits", 64, 128, nil},
+		{"header too large", 8, 128, network.ErrFrameTooLarge},
+		{"body too large", 64, 64, network.ErrFrameTooLarge},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &bufConn{limits: []int{tt.maxHeader, tt.maxBody}}
+			c := NewProtobufCodec(limitedConn{conn})
+			if err := c.Writer(&Header{ServiceMethod: "Arith.Echo", Seq: 1}, body); err != nil {
+				t.Fatal(err)
+			}
+			var h Header
+			if err := c.ReadHeader(&h); err != tt.err {
+				t.Fatalf("ReadHeader = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	// 超过限制的报文长度在读取报文内容之前被拒绝
+	conn := &bufConn{limits: []int{16, 16}}
+	conn.Write([]byte{0x80, 0x80, 0x04}) // 65536
+	c := NewProtobufCodec(limitedConn{conn})
+	var h Header
+	if err := c.ReadHeader(&h); err != network.ErrFrameTooLarge {
+		t.Fatalf("ReadHeader = %v, want ErrFrameTooLarge", err)
+	}
+}
@@ -8,4 +8,5 @@ const (
 	RegisterService time.Duration = time.Minute * 2               // 注册中心 服务器 过期时间，0：无限期、默认值：2m
 	SendHeartbeat   time.Duration = RegisterService - time.Minute // 发送心跳时间间隔，默认值：过期时间-1m
 	BalanceServices time.Duration = time.Second * 25              // 负载均衡 服务列表 过期时间，0：无限期、默认值：25s
+	RegisterDial    time.Duration = time.Second * 5               // 连接注册中心超时时间，0：不超时、默认值：5s
 )
@@ -2,4 +2,10 @@ module TinyRPC
 
 go 1.17
 
-require golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd
\ No newline at end of file
+require (
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	golang.org/x/sys v0.0.0-20200323222414-85ca7c5b95cd
+	google.golang.org/protobuf v1.33.0
+)
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
@@ -21,8 +21,18 @@ func (e *Epoll) Remove(fd int, event unix.EpollEvent) error {
 	return unix.EpollCtl(e.Epfd, unix.EPOLL_CTL_DEL, fd, &event)
 }
 
-func (e *Epoll) Wait() (int, error) {
-	return unix.EpollWait(e.Epfd, e.Events[:], -1)
+// Wait 等待事件，msec为超时时间（毫秒），-1表示一直等待
+func (e *Epoll) Wait(msec int) (int, error) {
+	return unix.EpollWait(e.Epfd, e.Events[:], msec)
+}
+
+// Event 返回Wait得到的第i个事件
+func (e *Epoll) Event(i int) unix.EpollEvent {
+	return e.Events[i]
+}
+
+func (e *Epoll) Close() error {
+	return unix.Close(e.Epfd)
 }
 
 func NewEpoll(size int) (*Epoll, error) {
@@ -1,10 +1,63 @@
 package iomux
 
-import "golang.org/x/sys/unix"
+import (
+	"log"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
 
 type IoMuX interface {
 	Add(fd int, event unix.EpollEvent) (err error)
 	Mod(fd int, event unix.EpollEvent) (err error)
 	Remove(fd int, event unix.EpollEvent) (err error)
-	Wait() (int, error)
+	Wait(msec int) (int, error)
+	Event(i int) unix.EpollEvent // Wait返回后第i个就绪的事件
+	Close() error
+}
+
+// Backend IoMuX的实现方式
+type Backend string
+
+const (
+	BackendEpoll   Backend = "epoll"
+	BackendIoUring Backend = "io_uring"
+)
+
+var (
+	uringOnce sync.Once
+	uringErr  error
+)
+
+// IoUringSupported 检查内核是否支持io_uring（5.5及以上，且没有被seccomp等禁用）
+func IoUringSupported() error {
+	uringOnce.Do(func() {
+		u, err := NewIoUring(1)
+		if err != nil {
+			uringErr = err
+			return
+		}
+		_ = u.Close()
+	})
+	return uringErr
+}
+
+// Resolve 返回backend实际使用的实现，backend为空或内核不支持io_uring时为BackendEpoll
+func Resolve(backend Backend) Backend {
+	if backend != BackendIoUring {
+		return BackendEpoll
+	}
+	if err := IoUringSupported(); err != nil {
+		log.Printf("iomux: io_uring unavailable (%v), falling back to epoll", err)
+		return BackendEpoll
+	}
+	return BackendIoUring
+}
+
+// New 创建backend对应的IoMuX，size为每次Wait最多返回的事件数，需要回退到epoll时先调用Resolve
+func New(backend Backend, size int) (IoMuX, error) {
+	if backend == BackendIoUring {
+		return NewIoUring(size)
+	}
+	return NewEpoll(size)
 }
@@ -0,0 +1,255 @@
+package iomux
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// 在每个实现上运行测试，内核不支持io_uring时跳过
+func forEachBackend(t *testing.T, f func(t *testing.T, m IoMuX)) {
+	for _, backend := range []Backend{BackendEpoll, BackendIoUring} {
+		t.Run(string(backend), func(t *testing.T) {
+			if backend == BackendIoUring {
+				if err := IoUringSupported(); err != nil {
+					t.Skip("io_uring not supported: ", err)
+				}
+			}
+			m, err := New(backend, 16)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+			f(t, m)
+		})
+	}
+}
+
+func newPipe(t *testing.T) (r, w int) {
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_NONBLOCK|unix.O_CLOEXEC); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = unix.Close(p[0])
+		_ = unix.Close(p[1])
+	})
+	return p[0], p[1]
+}
+
+func newSocketPair(t *testing.T) (a, b int) {
+	p, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = unix.Close(p[0])
+		_ = unix.Close(p[1])
+	})
+	return p[0], p[1]
+}
+
+func write(t *testing.T, fd int) {
+	if _, err := unix.Write(fd, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 等待msec毫秒，返回收到的事件，被信号中断（如goroutine抢占）时按剩余时间继续等待
+func wait(t *testing.T, m IoMuX, msec int) []unix.EpollEvent {
+	deadline := time.Now().Add(time.Duration(msec) * time.Millisecond)
+	for {
+		n, err := m.Wait(msec)
+		if err == unix.EINTR && n <= 0 {
+			if msec > 0 {
+				if msec = int(time.Until(deadline) / time.Millisecond); msec <= 0 {
+					return nil
+				}
+			}
+			continue
+		}
+		if err != nil { // 可能在其他goroutine中调用，不能使用Fatal
+			t.Error(err)
+			return nil
+		}
+		events := make([]unix.EpollEvent, n)
+		for i := range events {
+			events[i] = m.Event(i)
+		}
+		return events
+	}
+}
+
+// 期望只收到fd的一个事件，且包含want
+func expectEvent(t *testing.T, events []unix.EpollEvent, fd int, want uint32) {
+	t.Helper()
+	if len(events) != 1 || int(events[0].Fd) != fd || events[0].Events&want != want {
+		t.Fatalf("events = %+v, want fd %d with events %#x", events, fd, want)
+	}
+}
+
+func expectNone(t *testing.T, events []unix.EpollEvent) {
+	t.Helper()
+	if len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestIoMuXAdd(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m IoMuX) {
+		r, w := newPipe(t)
+		if err := m.Add(r, unix.EpollEvent{Fd: int32(r), Events: unix.EPOLLIN}); err != nil {
+			t.Fatal(err)
+		}
+		expectNone(t, wait(t, m, 0))
+
+		write(t, w)
+		expectEvent(t, wait(t, m, 1000), r, unix.EPOLLIN)
+	})
+}
+
+func TestIoMuXMod(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m IoMuX) {
+		a, b := newSocketPair(t)
+		if err := m.Add(a, unix.EpollEvent{Fd: int32(a), Events: unix.EPOLLIN}); err != nil {
+			t.Fatal(err)
+		}
+		expectNone(t, wait(t, m, 0))
+
+		// 改为监听可写，空的套接字立即可写
+		if err := m.Mod(a, unix.EpollEvent{Fd: int32(a), Events: unix.EPOLLOUT}); err != nil {
+			t.Fatal(err)
+		}
+		events := wait(t, m, 1000)
+		expectEvent(t, events, a, unix.EPOLLOUT)
+		if events[0].Events&unix.EPOLLIN != 0 {
+			t.Fatalf("EPOLLIN reported without data: %+v", events)
+		}
+
+		// 改回监听可读，数据到达后通知
+		if err := m.Mod(a, unix.EpollEvent{Fd: int32(a), Events: unix.EPOLLIN}); err != nil {
+			t.Fatal(err)
+		}
+		expectNone(t, wait(t, m, 50))
+		write(t, b)
+		expectEvent(t, wait(t, m, 1000), a, unix.EPOLLIN)
+	})
+}
+
+func TestIoMuXRemove(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m IoMuX) {
+		r, w := newPipe(t)
+		ev := unix.EpollEvent{Fd: int32(r), Events: unix.EPOLLIN}
+		if err := m.Add(r, ev); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Add(r, ev); err != unix.EEXIST {
+			t.Fatalf("second Add = %v, want EEXIST", err)
+		}
+		if err := m.Remove(r, ev); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Remove(r, ev); err != unix.ENOENT {
+			t.Fatalf("second Remove = %v, want ENOENT", err)
+		}
+		if err := m.Mod(r, ev); err != unix.ENOENT {
+			t.Fatalf("Mod after Remove = %v, want ENOENT", err)
+		}
+
+		// 移除后不再通知
+		write(t, w)
+		expectNone(t, wait(t, m, 50))
+
+		// 可以重新添加
+		if err := m.Add(r, ev); err != nil {
+			t.Fatal(err)
+		}
+		expectEvent(t, wait(t, m, 1000), r, unix.EPOLLIN)
+	})
+}
+
+func TestIoMuXWaitTimeout(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m IoMuX) {
+		r, _ := newPipe(t)
+		if err := m.Add(r, unix.EpollEvent{Fd: int32(r), Events: unix.EPOLLIN}); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		expectNone(t, wait(t, m, 0))
+		if d := time.Since(start); d > 50*time.Millisecond {
+			t.Fatalf("Wait(0) blocked for %v", d)
+		}
+
+		// 连续等待，上一次的timeout不能提前唤醒下一次
+		for i := 0; i < 3; i++ {
+			start = time.Now()
+			expectNone(t, wait(t, m, 100))
+			if d := time.Since(start); d < 90*time.Millisecond || d > time.Second {
+				t.Fatalf("Wait(100) returned after %v", d)
+			}
+		}
+
+		// 较短的等待之后较长的等待
+		expectNone(t, wait(t, m, 10))
+		start = time.Now()
+		expectNone(t, wait(t, m, 200))
+		if d := time.Since(start); d < 190*time.Millisecond {
+			t.Fatalf("Wait(200) returned after %v", d)
+		}
+	})
+}
+
+// 没有调用Mod的文件描述符在下次Wait时继续监听，如Waker
+func TestIoMuXRearm(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m IoMuX) {
+		waker, err := NewWaker()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer waker.Close()
+		if err = m.Add(waker.Fd, unix.EpollEvent{Fd: int32(waker.Fd), Events: unix.EPOLLIN}); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			if err = waker.Wake(); err != nil {
+				t.Fatal(err)
+			}
+			expectEvent(t, wait(t, m, 1000), waker.Fd, unix.EPOLLIN)
+			waker.Reset()
+			expectNone(t, wait(t, m, 50))
+		}
+
+		// 未读出计数器时继续通知
+		_ = waker.Wake()
+		expectEvent(t, wait(t, m, 1000), waker.Fd, unix.EPOLLIN)
+		expectEvent(t, wait(t, m, 1000), waker.Fd, unix.EPOLLIN)
+		waker.Reset()
+	})
+}
+
+// 在其他goroutine中添加的文件描述符可以唤醒正在等待的Wait
+func TestIoMuXAddDuringWait(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, m IoMuX) {
+		r, w := newPipe(t)
+		write(t, w)
+
+		done := make(chan []unix.EpollEvent, 1)
+		go func() {
+			done <- wait(t, m, -1)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		if err := m.Add(r, unix.EpollEvent{Fd: int32(r), Events: unix.EPOLLIN}); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case events := <-done:
+			expectEvent(t, events, r, unix.EPOLLIN)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Wait not woken by Add")
+		}
+	})
+}
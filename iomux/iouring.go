@@ -0,0 +1,430 @@
+package iomux
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// IoUring 基于io_uring的IoMuX，使用一次性的IORING_OP_POLL_ADD实现就绪通知，与Epoll的用法相同
+// 一个poll完成后不再监听，事件循环在处理事件时调用Mod重新监听；没有调用Mod的文件描述符（如Waker）在下次Wait时重新监听
+// Add、Mod、Remove可以在其他goroutine中与Wait并发调用，提交队列由mu保护
+
+// io_uring系统调用号，所有架构相同
+const (
+	sysIoUringSetup = 425
+	sysIoUringEnter = 426
+)
+
+// mmap偏移量
+const (
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+)
+
+// 操作码
+const (
+	uringOpPollAdd       = 6
+	uringOpPollRemove    = 7
+	uringOpTimeout       = 11
+	uringOpTimeoutRemove = 12
+)
+
+const (
+	uringEnterGetEvents = 1 << 0
+	uringFeatSingleMmap = 1 << 0
+	uringFeatNoDrop     = 1 << 1 // 5.5，同时支持TIMEOUT_REMOVE
+
+	uringMaxEntries = 4096
+	uringInternal   = 1 << 63 // user_data最高位为1表示timeout等内部请求，fd不会为负数
+	uringPollEvents = unix.EPOLLIN | unix.EPOLLOUT | unix.EPOLLPRI | unix.EPOLLRDHUP | unix.EPOLLERR | unix.EPOLLHUP
+)
+
+var errUringSQFull = errors.New("iomux: io_uring submission queue full")
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	resv2                                                           uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	resv2                                                           uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode   uint8
+	flags    uint8
+	ioprio   uint16
+	fd       int32
+	off      uint64
+	addr     uint64
+	len      uint32
+	opFlags  uint32 // poll32_events、timeout_flags等
+	userData uint64
+	_        [3]uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+// 文件描述符的监听状态
+type uringPoll struct {
+	events uint32 // 需要监听的事件
+	armed  uint64 // 正在等待的poll的user_data，0表示没有
+}
+
+type IoUring struct {
+	Fd     int // io_uring实例的文件描述符
+	Events []unix.EpollEvent
+
+	mu       sync.Mutex // 保护提交队列、polls、unarmed
+	sqRing   []byte
+	cqRing   []byte
+	sqes     []byte
+	sqHead   *uint32
+	sqTail   *uint32
+	sqMask   uint32
+	sqArray  unsafe.Pointer
+	cqHead   *uint32
+	cqTail   *uint32
+	cqMask   uint32
+	cqes     unsafe.Pointer
+	entries  uint32
+	toSubmit uint32 // 已写入提交队列但还未提交的请求数
+
+	polls   map[int]*uringPoll // 每个文件描述符的监听状态
+	unarmed []int              // poll已完成、下次Wait时需要重新监听的文件描述符
+	gen     uint32             // poll的序号，用于忽略已取消或已替换的poll的完成事件
+
+	ts      unix.Timespec // Wait超时时间，提交时由内核复制
+	timeout uint64        // 正在等待的timeout的user_data，0表示没有
+}
+
+func (u *IoUring) Add(fd int, event unix.EpollEvent) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if _, ok := u.polls[fd]; ok {
+		return unix.EEXIST
+	}
+	p := &uringPoll{}
+	u.polls[fd] = p
+	return u.update(fd, p, event.Events)
+}
+
+func (u *IoUring) Mod(fd int, event unix.EpollEvent) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p, ok := u.polls[fd]
+	if !ok {
+		return unix.ENOENT
+	}
+	return u.update(fd, p, event.Events)
+}
+
+func (u *IoUring) Remove(fd int, event unix.EpollEvent) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	p, ok := u.polls[fd]
+	if !ok {
+		return unix.ENOENT
+	}
+	delete(u.polls, fd)
+	if p.armed != 0 {
+		if err := u.cancel(p); err != nil {
+			return err
+		}
+	}
+	return u.submit()
+}
+
+// Wait 等待事件，msec为超时时间（毫秒），-1表示一直等待
+func (u *IoUring) Wait(msec int) (int, error) {
+	u.mu.Lock()
+	u.rearm()
+	if msec > 0 {
+		u.setTimeout(msec)
+	}
+	err := u.submit()
+	ready := atomic.LoadUint32(u.cqTail) != atomic.LoadUint32(u.cqHead)
+	u.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	if !ready && msec != 0 {
+		if _, err = u.enter(0, 1, uringEnterGetEvents); err != nil && err != unix.EINTR {
+			return 0, err
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	n := u.reap()
+	u.clearTimeout() // 取消还未到期的timeout，避免之后的Wait被提前唤醒
+	_ = u.submit()
+	if n == 0 && err == unix.EINTR {
+		return 0, err
+	}
+	return n, nil
+}
+
+// 提交Wait的超时，完成队列为空时io_uring_enter在超时后返回
+func (u *IoUring) setTimeout(msec int) {
+	u.clearTimeout()
+	sqe := u.getSQE()
+	if sqe == nil {
+		return
+	}
+	u.ts = unix.NsecToTimespec(int64(msec) * 1e6)
+	u.gen++
+	u.timeout = uringInternal | uint64(u.gen)
+	sqe.opcode = uringOpTimeout
+	sqe.fd = -1
+	sqe.addr = uint64(uintptr(unsafe.Pointer(&u.ts)))
+	sqe.len = 1
+	sqe.userData = u.timeout
+}
+
+// 取消正在等待的timeout
+func (u *IoUring) clearTimeout() {
+	if u.timeout == 0 {
+		return
+	}
+	if sqe := u.getSQE(); sqe != nil {
+		sqe.opcode = uringOpTimeoutRemove
+		sqe.fd = -1
+		sqe.addr = u.timeout
+		sqe.userData = uringInternal
+	}
+	u.timeout = 0
+}
+
+// Event 返回Wait得到的第i个事件
+func (u *IoUring) Event(i int) unix.EpollEvent {
+	return u.Events[i]
+}
+
+func (u *IoUring) Close() error {
+	_ = unix.Munmap(u.sqes)
+	if u.cqRing != nil {
+		_ = unix.Munmap(u.cqRing)
+	}
+	_ = unix.Munmap(u.sqRing)
+	return unix.Close(u.Fd)
+}
+
+// 修改需要监听的事件，正在等待的poll监听的事件不同时取消并重新提交
+func (u *IoUring) update(fd int, p *uringPoll, events uint32) error {
+	events &= uringPollEvents
+	if p.armed != 0 {
+		if p.events == events {
+			return nil
+		}
+		if err := u.cancel(p); err != nil {
+			return err
+		}
+	}
+	p.events = events
+	if events != 0 {
+		if err := u.arm(fd, p); err != nil {
+			return err
+		}
+	}
+	return u.submit()
+}
+
+// 提交一次性的poll
+func (u *IoUring) arm(fd int, p *uringPoll) error {
+	sqe := u.getSQE()
+	if sqe == nil {
+		return errUringSQFull
+	}
+	u.gen++
+	p.armed = uint64(fd)<<32 | uint64(u.gen)
+	sqe.opcode = uringOpPollAdd
+	sqe.fd = int32(fd)
+	sqe.opFlags = p.events
+	sqe.userData = p.armed
+	return nil
+}
+
+// 取消正在等待的poll，被取消的poll的完成事件在reap时忽略
+func (u *IoUring) cancel(p *uringPoll) error {
+	sqe := u.getSQE()
+	if sqe == nil {
+		return errUringSQFull
+	}
+	sqe.opcode = uringOpPollRemove
+	sqe.fd = -1
+	sqe.addr = p.armed
+	sqe.userData = uringInternal
+	p.armed = 0
+	return nil
+}
+
+// 重新监听poll已完成但事件循环没有调用Mod的文件描述符
+func (u *IoUring) rearm() {
+	for i, fd := range u.unarmed {
+		if p, ok := u.polls[fd]; ok && p.armed == 0 && p.events != 0 {
+			if u.arm(fd, p) != nil { // 提交队列已满，剩余的下次Wait继续
+				u.unarmed = append(u.unarmed[:0], u.unarmed[i:]...)
+				return
+			}
+		}
+	}
+	u.unarmed = u.unarmed[:0]
+}
+
+// 读取完成队列，将poll的结果转换为EpollEvent，最多读取len(Events)个事件，其余的留在完成队列中
+func (u *IoUring) reap() (n int) {
+	head := atomic.LoadUint32(u.cqHead)
+	tail := atomic.LoadUint32(u.cqTail)
+	for ; head != tail && n < len(u.Events); head++ {
+		cqe := (*uringCQE)(unsafe.Pointer(uintptr(u.cqes) + uintptr(head&u.cqMask)*unsafe.Sizeof(uringCQE{})))
+		ud := cqe.userData
+		if ud&uringInternal != 0 {
+			if ud == u.timeout {
+				u.timeout = 0
+			}
+			continue
+		}
+
+		fd := int(ud >> 32)
+		p, ok := u.polls[fd]
+		if !ok || p.armed != ud { // 已取消或已被替换
+			continue
+		}
+		p.armed = 0
+		events := uint32(cqe.res)
+		if cqe.res < 0 { // poll失败时通知读写，由读写返回具体的错误
+			events = p.events | unix.EPOLLERR
+		}
+		// 与EPOLLET一样，出错或挂断只通知一次，直到事件循环调用Mod，避免重复监听立即返回
+		if events&(unix.EPOLLERR|unix.EPOLLHUP) == 0 {
+			u.unarmed = append(u.unarmed, fd)
+		}
+		u.Events[n] = unix.EpollEvent{Fd: int32(fd), Events: events}
+		n++
+	}
+	atomic.StoreUint32(u.cqHead, head)
+	return
+}
+
+// 获取一个空闲的提交队列项，队列已满时先提交
+func (u *IoUring) getSQE() *uringSQE {
+	tail := atomic.LoadUint32(u.sqTail)
+	if tail-atomic.LoadUint32(u.sqHead) >= u.entries {
+		if u.submit() != nil || tail-atomic.LoadUint32(u.sqHead) >= u.entries {
+			return nil
+		}
+	}
+	idx := tail & u.sqMask
+	sqe := (*uringSQE)(unsafe.Pointer(&u.sqes[uintptr(idx)*unsafe.Sizeof(uringSQE{})]))
+	*sqe = uringSQE{}
+	*(*uint32)(unsafe.Pointer(uintptr(u.sqArray) + uintptr(idx)*4)) = idx
+	atomic.StoreUint32(u.sqTail, tail+1)
+	u.toSubmit++
+	return sqe
+}
+
+// 提交队列中的请求，不等待完成
+func (u *IoUring) submit() error {
+	for u.toSubmit > 0 {
+		n, err := u.enter(u.toSubmit, 0, 0)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return err
+		}
+		u.toSubmit -= uint32(n)
+	}
+	return nil
+}
+
+func (u *IoUring) enter(toSubmit, minComplete, flags uint32) (int, error) {
+	n, _, errno := unix.Syscall6(sysIoUringEnter, uintptr(u.Fd), uintptr(toSubmit), uintptr(minComplete), uintptr(flags), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(n), nil
+}
+
+// NewIoUring 创建io_uring实例，size为每次Wait最多返回的事件数，内核不支持io_uring（或版本低于5.5）时返回错误
+func NewIoUring(size int) (*IoUring, error) {
+	entries := uint32(1)
+	for entries < uint32(size) && entries < uringMaxEntries {
+		entries <<= 1
+	}
+
+	var p uringParams
+	fd, _, errno := unix.Syscall(sysIoUringSetup, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	u := &IoUring{
+		Fd:      int(fd),
+		Events:  make([]unix.EpollEvent, size),
+		entries: p.sqEntries,
+		polls:   make(map[int]*uringPoll),
+	}
+	unix.CloseOnExec(u.Fd)
+	if p.features&uringFeatNoDrop == 0 {
+		_ = unix.Close(u.Fd)
+		return nil, unix.ENOSYS
+	}
+
+	var err error
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	if p.features&uringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+	if u.sqRing, err = unix.Mmap(u.Fd, uringOffSQRing, sqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		_ = unix.Close(u.Fd)
+		return nil, err
+	}
+	cqRing := u.sqRing
+	if p.features&uringFeatSingleMmap == 0 {
+		if u.cqRing, err = unix.Mmap(u.Fd, uringOffCQRing, cqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+			_ = unix.Munmap(u.sqRing)
+			_ = unix.Close(u.Fd)
+			return nil, err
+		}
+		cqRing = u.cqRing
+	}
+	sqesSize := int(p.sqEntries) * int(unsafe.Sizeof(uringSQE{}))
+	if u.sqes, err = unix.Mmap(u.Fd, uringOffSQEs, sqesSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE); err != nil {
+		if u.cqRing != nil {
+			_ = unix.Munmap(u.cqRing)
+		}
+		_ = unix.Munmap(u.sqRing)
+		_ = unix.Close(u.Fd)
+		return nil, err
+	}
+
+	u.sqHead = (*uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.head]))
+	u.sqTail = (*uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.tail]))
+	u.sqMask = *(*uint32)(unsafe.Pointer(&u.sqRing[p.sqOff.ringMask]))
+	u.sqArray = unsafe.Pointer(&u.sqRing[p.sqOff.array])
+	u.cqHead = (*uint32)(unsafe.Pointer(&cqRing[p.cqOff.head]))
+	u.cqTail = (*uint32)(unsafe.Pointer(&cqRing[p.cqOff.tail]))
+	u.cqMask = *(*uint32)(unsafe.Pointer(&cqRing[p.cqOff.ringMask]))
+	u.cqes = unsafe.Pointer(&cqRing[p.cqOff.cqes])
+	return u, nil
+}
@@ -0,0 +1,40 @@
+package iomux
+
+import (
+	"encoding/binary"
+	"golang.org/x/sys/unix"
+)
+
+// Waker 基于eventfd，用于唤醒阻塞在Wait中的ioMux
+type Waker struct {
+	Fd int
+}
+
+// Wake 写入eventfd计数器，使监听该eventfd的ioMux返回可读事件
+func (w *Waker) Wake() error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], 1)
+	_, err := unix.Write(w.Fd, b[:])
+	if err == unix.EAGAIN { // 计数器已满，说明已有未处理的唤醒
+		return nil
+	}
+	return err
+}
+
+// Reset 读出eventfd计数器，避免重复触发
+func (w *Waker) Reset() {
+	var b [8]byte
+	_, _ = unix.Read(w.Fd, b[:])
+}
+
+func (w *Waker) Close() error {
+	return unix.Close(w.Fd)
+}
+
+func NewWaker() (*Waker, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_EVENTFD2, 0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return &Waker{Fd: int(fd)}, nil
+}
@@ -0,0 +1,86 @@
+package metadata
+
+import "context"
+
+// 请求元数据，随codec.Header发送给服务端，用于传递鉴权token、trace ID、租户ID等
+
+// MD 请求元数据
+type MD map[string]string
+
+// New 根据map创建元数据，会复制m
+func New(m map[string]string) MD {
+	md := make(MD, len(m))
+	for k, v := range m {
+		md[k] = v
+	}
+	return md
+}
+
+// Pairs 根据键值对创建元数据，kv的长度必须为偶数
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic("metadata: Pairs got the odd number of input pairs")
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md[kv[i]] = kv[i+1]
+	}
+	return md
+}
+
+// Get 获取key对应的值，不存在时返回空字符串
+func (md MD) Get(key string) string {
+	return md[key]
+}
+
+// Set 设置key对应的值
+func (md MD) Set(key, value string) {
+	md[key] = value
+}
+
+// Copy 复制元数据
+func (md MD) Copy() MD {
+	return New(md)
+}
+
+// Join 合并多个元数据，相同的key以后面的为准
+func Join(mds ...MD) MD {
+	out := MD{}
+	for _, md := range mds {
+		for k, v := range md {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+type incomingKey struct{}
+type outgoingKey struct{}
+
+// NewIncomingContext 服务端将收到的元数据保存到请求的context中
+func NewIncomingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, incomingKey{}, md)
+}
+
+// FromIncomingContext 服务端从请求的context中获取客户端发送的元数据
+func FromIncomingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(incomingKey{}).(MD)
+	return md, ok
+}
+
+// NewOutgoingContext 客户端将需要发送的元数据保存到context中，替换ctx中已有的元数据
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, outgoingKey{}, md)
+}
+
+// FromOutgoingContext 获取context中需要发送的元数据
+func FromOutgoingContext(ctx context.Context) (MD, bool) {
+	md, ok := ctx.Value(outgoingKey{}).(MD)
+	return md, ok
+}
+
+// AppendToOutgoingContext 在ctx已有的元数据上追加键值对，不修改ctx中原有的元数据
+func AppendToOutgoingContext(ctx context.Context, kv ...string) context.Context {
+	md, _ := FromOutgoingContext(ctx)
+	return NewOutgoingContext(ctx, Join(md, Pairs(kv...)))
+}
@@ -0,0 +1,108 @@
+package network
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sync"
+)
+
+// 帧体压缩，压缩方式在协商报文中确定，只压缩长度不小于阈值的帧，每一帧通过首部的标志位标识是否压缩
+
+type Compression string
+
+const (
+	CompressionNone  Compression = ""
+	CompressionGzip  Compression = "gzip"
+	CompressionFlate Compression = "flate"
+)
+
+// DefaultCompressMinSize 默认压缩阈值，小于阈值的帧压缩收益不大，直接发送
+const DefaultCompressMinSize = 1024
+
+// Compressor 压缩算法要实现的接口，需要支持并发调用
+type Compressor interface {
+	Compress(dst io.Writer, src []byte) error
+	Decompress(src []byte, limit int) ([]byte, error) // 解压后的长度超过limit时返回错误
+}
+
+// Compressors 压缩算法通过写入Compressors实现注册
+var Compressors = map[Compression]Compressor{
+	CompressionGzip:  &gzipCompressor{},
+	CompressionFlate: &flateCompressor{},
+}
+
+func RegisterCompressor(c Compression, compressor Compressor) {
+	Compressors[c] = compressor
+}
+
+var errDecompressTooLarge = errors.New("network: decompressed frame too large")
+
+type gzipCompressor struct {
+	writers sync.Pool
+}
+
+func (g *gzipCompressor) Compress(dst io.Writer, src []byte) error {
+	w, _ := g.writers.Get().(*gzip.Writer)
+	if w == nil {
+		w = gzip.NewWriter(dst)
+	} else {
+		w.Reset(dst)
+	}
+	defer g.writers.Put(w)
+
+	if _, err := w.Write(src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (g *gzipCompressor) Decompress(src []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimit(r, limit)
+}
+
+type flateCompressor struct {
+	writers sync.Pool
+}
+
+func (f *flateCompressor) Compress(dst io.Writer, src []byte) (err error) {
+	w, _ := f.writers.Get().(*flate.Writer)
+	if w == nil {
+		if w, err = flate.NewWriter(dst, flate.DefaultCompression); err != nil {
+			return
+		}
+	} else {
+		w.Reset(dst)
+	}
+	defer f.writers.Put(w)
+
+	if _, err = w.Write(src); err != nil {
+		return
+	}
+	return w.Close()
+}
+
+func (f *flateCompressor) Decompress(src []byte, limit int) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return readLimit(r, limit)
+}
+
+// 读取全部解压数据，防止压缩炸弹
+func readLimit(r io.Reader, limit int) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > limit {
+		return nil, errDecompressTooLarge
+	}
+	return b, nil
+}
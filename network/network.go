@@ -1,22 +1,63 @@
 package network
 
 import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"golang.org/x/sys/unix"
 	"net"
 	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // 封装读写，解决粘包问题
+// 每次Write发送一帧：| 压缩标志(最高位) + 帧体长度 4B(大端) | header长度 4B(大端) | 帧体 |，序列化器一次写入一个完整的报文
+// 帧体为header与body，header长度为压缩前的长度，接收方在缓存帧体之前检查header和body的长度
+// 读取时先将数据读入缓冲区，收到完整的帧后才交给序列化器，非阻塞读取返回EAGAIN时已读取的数据保留在缓冲区中
+
+const (
+	frameHeadLen         = 8         // 帧首部长度
+	maxFrameSize         = 1<<31 - 1 // 帧体长度字段能表示的最大长度
+	frameCompressed      = 1 << 31   // 帧体已压缩的标志位
+	minReadSize          = 4096      // 每次从套接字读取时缓冲区至少预留的空间
+	DefaultMaxHeaderSize = 1 << 20   // 默认header最大长度
+	DefaultMaxBodySize   = 64 << 20  // 默认body最大长度
+)
+
+// ErrFrameTooLarge 收到的header或body超过长度限制
+var ErrFrameTooLarge = errors.New("network: frame too large")
 
 type Conn struct {
-	Fd        int
-	conn      net.Conn
-	isFd      bool          // 记录是用fd还是net.conn创建的network实例
-	noFrist   bool          // 判断是不是第一个报文，第一个报文是协商数据，需要解决粘包获取。客户端第一个发送的是协商报文、服务端第一个收到的是协商报文
-	head      uint8         // 读取到的协商报文首部长度
-	writeChan chan int      // 通知subReactor监听write事件
-	wait      chan struct{} // 等待subReactor通知文件描述符可写
+	Fd          int
+	conn        net.Conn
+	isFd        bool          // 记录是用fd还是net.conn创建的network实例
+	rbuf        []byte        // 读缓冲区，rbuf[r:]为已从套接字读取但还未被读取的数据
+	r           int           // 读缓冲区的读取位置
+	frame       []byte        // 当前帧还未被读取的数据
+	comp        Compressor    // 帧体压缩算法，为nil时不压缩
+	compMin     int           // 帧体长度不小于compMin时压缩
+	maxHeader   int           // 接收的header最大长度
+	maxBody     int           // 接收的body最大长度
+	remote      net.Addr      // 对端地址
+	raw         *fdConn       // 服务端使用TLS时，tls.Conn底层的fd
+	tls         *tls.Conn     // 服务端使用TLS时的tls连接，为nil时直接读写fd
+	armRead     func() error  // TLS握手阶段重新监听可读事件
+	readable    chan struct{} // TLS握手阶段等待subReactor通知fd可读
+	handshaking int32         // TLS握手还未完成，为1时subReactor将可读事件通知给握手，使用原子操作
+	writeChan   chan int      // 通知subReactor监听write事件
+	wait        chan struct{} // 等待subReactor通知文件描述符可写
+	closed      chan struct{} // 连接关闭后，结束等待可写的write
+	closeOnce   sync.Once
+
+	// 以下字段由subReactor的时间轮读取，使用原子操作
+	lastActive int64 // 最近一次收到或发送数据的时间（UnixNano）
+	partial    int64 // 开始等待当前帧的时间（UnixNano），0表示没有未收完的帧，服务端新连接从建立开始等待协商报文
+	inflight   int32 // 已收到但还未发送响应的请求数
+	created    int64 // 连接建立的时间（UnixNano），只读
 }
 
 // NewConnByFd 匹配服务端
@@ -26,6 +67,8 @@ func NewConnByFd(fd int, wait chan struct{}, writeChan chan int) *Conn {
 	c.isFd = true
 	c.writeChan = writeChan
 	c.wait = wait
+	c.partial = c.lastActive
+	c.created = c.lastActive
 	return c
 }
 
@@ -38,50 +81,129 @@ func NewConnByConn(conn net.Conn) *Conn {
 }
 
 func newConn() *Conn {
-	return &Conn{}
+	return &Conn{
+		closed:     make(chan struct{}),
+		maxHeader:  DefaultMaxHeaderSize,
+		maxBody:    DefaultMaxBodySize,
+		lastActive: time.Now().UnixNano(),
+	}
 }
 
+// Read 读取当前帧的数据，一次Read不会跨越帧的边界
+// 当前帧读取完后继续读取下一帧，fd模式下数据不足一帧时返回EAGAIN
 func (c *Conn) Read(b []byte) (n int, err error) {
-	if !c.noFrist {
-		// 第一个报文，协商报文，需要解决粘包
-		if c.head == 0 {
-			head := make([]byte, 1)
-			n, err = c.read(head)
-			if n == 1 {
-				c.head = head[0]
-			}
+	if len(c.frame) == 0 {
+		if err = c.nextFrame(); err != nil {
+			return 0, err
 		}
+	}
 
-		if err == nil {
-			// 读取协商报文体
-			t := cap(b)
-			if t > int(c.head) {
-				t = int(c.head)
+	n = copy(b, c.frame)
+	c.frame = c.frame[n:]
+	return
+}
+
+// NextFrame 丢弃当前帧未读取的数据，并确认缓冲区中已有下一个完整的帧，用于handlerRead池只反序列化完整的报文
+// 返回EAGAIN表示数据还未全部到达，已读取的数据保留在缓冲区中
+func (c *Conn) NextFrame() error {
+	c.frame = nil // 如json报文末尾的换行符
+	return c.nextFrame()
+}
+
+func (c *Conn) nextFrame() error {
+	for {
+		ok, err := c.parseFrame()
+		if ok {
+			atomic.StoreInt64(&c.partial, 0)
+		}
+		if err != nil || ok {
+			return err
+		}
+		if err = c.fill(); err != nil {
+			// 收到了帧的一部分，开始计算读取超时
+			if len(c.rbuf) > c.r && atomic.LoadInt64(&c.partial) == 0 {
+				atomic.StoreInt64(&c.partial, time.Now().UnixNano())
 			}
+			return err
+		}
+	}
+}
 
-			n, err = c.read(b[:t])
-			if err == nil {
-				if uint8(n) == c.head {
-					c.noFrist = true
-				} else {
-					c.head -= uint8(n)
-				}
+// 解析缓冲区中的帧首部，缓冲区中有完整的帧时返回true，跳过长度为0的帧
+func (c *Conn) parseFrame() (bool, error) {
+	for len(c.rbuf)-c.r >= frameHeadLen {
+		head := binary.BigEndian.Uint32(c.rbuf[c.r:])
+		headerLen := int(binary.BigEndian.Uint32(c.rbuf[c.r+4:]))
+		size := int(head &^ frameCompressed)
+		// 在缓存帧体之前检查长度，压缩的帧在解压时检查
+		if headerLen > c.maxHeader || size > c.maxHeader+c.maxBody ||
+			(head&frameCompressed == 0 && (headerLen > size || size-headerLen > c.maxBody)) {
+			return false, ErrFrameTooLarge
+		}
+		if len(c.rbuf)-c.r-frameHeadLen < size {
+			return false, nil
+		}
+		c.r += frameHeadLen
+		frame := c.rbuf[c.r : c.r+size : c.r+size]
+		c.r += size
+
+		if head&frameCompressed != 0 {
+			if c.comp == nil {
+				return false, errors.New("network: compressed frame without compression")
+			}
+			var err error
+			if frame, err = c.comp.Decompress(frame, c.maxHeader+c.maxBody); err != nil {
+				return false, err
+			}
+			if headerLen > len(frame) || len(frame)-headerLen > c.maxBody {
+				return false, ErrFrameTooLarge
 			}
 		}
-	} else {
-		n, err = c.read(b)
+		if len(frame) > 0 {
+			c.frame = frame
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
+// 从套接字读取一次数据追加到缓冲区，当前帧读取完后才会调用，移动缓冲区中的数据不影响c.frame
+func (c *Conn) fill() error {
+	if c.r == len(c.rbuf) {
+		c.rbuf, c.r = c.rbuf[:0], 0
+	}
+	if cap(c.rbuf)-len(c.rbuf) < minReadSize {
+		// 先把未读取的数据移动到缓冲区开头，空间仍不足时扩容
+		unread := len(c.rbuf) - c.r
+		if cap(c.rbuf)-unread < minReadSize {
+			rbuf := make([]byte, unread, 2*cap(c.rbuf)+minReadSize)
+			copy(rbuf, c.rbuf[c.r:])
+			c.rbuf = rbuf
+		} else {
+			copy(c.rbuf, c.rbuf[c.r:])
+			c.rbuf = c.rbuf[:unread]
+		}
+		c.r = 0
+	}
+
+	n, err := c.read(c.rbuf[len(c.rbuf):cap(c.rbuf)])
 	if n == 0 {
-		return n, errors.New("close")
+		return errors.New("close")
 	} else if n == -1 {
-		return 0, err
+		return err
 	}
-	return
+	c.rbuf = c.rbuf[:len(c.rbuf)+n]
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+	return nil
 }
 
 func (c *Conn) read(b []byte) (n int, err error) {
-	if c.isFd {
+	if c.tls != nil {
+		n, err = c.tls.Read(b)
+		if err == errWouldBlock {
+			return -1, unix.EAGAIN
+		}
+	} else if c.isFd {
 		n, err = unix.Read(c.Fd, b)
 	} else {
 		n, err = c.conn.Read(b)
@@ -91,39 +213,107 @@ func (c *Conn) read(b []byte) (n int, err error) {
 	return
 }
 
+// Write 将b作为一帧发送，b全部作为header，用于协商报文等不区分header和body的数据
 func (c *Conn) Write(b []byte) (n int, err error) {
-	if !c.noFrist {
-		head := make([]byte, 1)
-		head[0] = byte(len(b))
-		n, err = c.write(head)
-		if n == 1 {
-			var t int
-			for err == nil && t != len(b) {
-				n, err = c.write(b)
-				t += n
-			}
-			c.noFrist = true
+	return c.WriteFrame(b, nil)
+}
+
+// WriteFrame 将header和body作为一帧发送，实现codec.FrameWriter
+// 设置了压缩算法且长度不小于阈值时压缩，压缩后没有变小则不压缩
+func (c *Conn) WriteFrame(header, body []byte) (n int, err error) {
+	size := len(header) + len(body)
+	if size > maxFrameSize {
+		return 0, ErrFrameTooLarge
+	}
+
+	frame := make([]byte, frameHeadLen+size)
+	binary.BigEndian.PutUint32(frame, uint32(size))
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(header)))
+	copy(frame[frameHeadLen:], header)
+	copy(frame[frameHeadLen+len(header):], body)
+
+	if c.comp != nil && size >= c.compMin {
+		buf := bytes.NewBuffer(make([]byte, frameHeadLen, frameHeadLen+size/2))
+		if err = c.comp.Compress(buf, frame[frameHeadLen:]); err != nil {
+			return 0, err
+		}
+		if buf.Len()-frameHeadLen < size {
+			compressed := buf.Bytes()
+			binary.BigEndian.PutUint32(compressed, uint32(len(compressed)-frameHeadLen)|frameCompressed)
+			binary.BigEndian.PutUint32(compressed[4:], uint32(len(header)))
+			frame = compressed
 		}
-	} else {
-		n, err = c.write(b)
 	}
 
-	return
+	if _, err = c.write(frame); err != nil {
+		return 0, err
+	}
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+	return size, nil
+}
+
+// SetLimits 设置接收的header和body最大长度，不大于0时使用默认值
+// 需要在连接上没有正在进行的读取时调用
+func (c *Conn) SetLimits(maxHeader, maxBody int) {
+	if maxHeader <= 0 {
+		maxHeader = DefaultMaxHeaderSize
+	}
+	if maxBody <= 0 {
+		maxBody = DefaultMaxBodySize
+	}
+	c.maxHeader, c.maxBody = maxHeader, maxBody
+}
+
+// Limits 接收的header和body最大长度
+func (c *Conn) Limits() (maxHeader, maxBody int) {
+	return c.maxHeader, c.maxBody
+}
+
+// LastActive 最近一次收到或发送数据的时间
+func (c *Conn) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.lastActive))
+}
+
+// PartialSince 有未收完的帧时返回开始等待该帧的时间
+func (c *Conn) PartialSince() (time.Time, bool) {
+	partial := atomic.LoadInt64(&c.partial)
+	return time.Unix(0, partial), partial != 0
+}
+
+// AddInflight 修改已收到但还未发送响应的请求数
+func (c *Conn) AddInflight(delta int32) {
+	atomic.AddInt32(&c.inflight, delta)
+}
+
+// Inflight 已收到但还未发送响应的请求数
+func (c *Conn) Inflight() int32 {
+	return atomic.LoadInt32(&c.inflight)
+}
+
+// SetCompression 设置帧体压缩方式，minSize为压缩阈值，不大于0时使用DefaultCompressMinSize
+// 需要在协商报文收发完成后、连接上没有正在进行的读写时调用
+func (c *Conn) SetCompression(compression Compression, minSize int) error {
+	if compression == CompressionNone {
+		c.comp = nil
+		return nil
+	}
+	comp := Compressors[compression]
+	if comp == nil {
+		return fmt.Errorf("network: invalid compression %s", compression)
+	}
+	if minSize <= 0 {
+		minSize = DefaultCompressMinSize
+	}
+	c.comp = comp
+	c.compMin = minSize
+	return nil
 }
 
 func (c *Conn) write(b []byte) (n int, err error) {
-	if c.isFd {
-		var tmp int
-		for n < len(b) {
-			tmp, err = unix.Write(c.Fd, b[n:])
-			if tmp > 0 {
-				n += tmp
-			}
-			if n < len(b) {
-				c.writeChan <- c.Fd
-				_ = <-c.wait
-			}
-		}
+	if c.tls != nil {
+		n, err = c.tls.Write(b)
+	} else if c.isFd {
+		n, err = c.writeFd(b)
 	} else {
 		n, err = c.conn.Write(b)
 	}
@@ -132,7 +322,54 @@ func (c *Conn) write(b []byte) (n int, err error) {
 	return
 }
 
+// 写入fd，发送缓冲区已满时等待subReactor通知可写
+func (c *Conn) writeFd(b []byte) (n int, err error) {
+	var tmp int
+	for n < len(b) {
+		tmp, err = unix.Write(c.Fd, b[n:])
+		if tmp > 0 {
+			n += tmp
+		}
+		if err != nil && err != unix.EAGAIN {
+			break
+		}
+		if n < len(b) {
+			// 发送缓冲区已满，等待subReactor通知可写
+			select {
+			case c.writeChan <- c.Fd:
+			case <-c.closed:
+				return n, errors.New("close")
+			}
+			select {
+			case <-c.wait:
+			case <-c.closed:
+				return n, errors.New("close")
+			}
+		}
+	}
+	if n == len(b) {
+		err = nil
+	}
+	return
+}
+
+// RemoteAddr 返回对端地址，服务端为accept时返回的地址
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.isFd {
+		return c.remote
+	}
+	return c.conn.RemoteAddr()
+}
+
+// SetRemoteAddr 设置服务端连接的对端地址
+func (c *Conn) SetRemoteAddr(addr net.Addr) {
+	c.remote = addr
+}
+
 func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
 	if c.isFd {
 		return unix.Close(c.Fd)
 	} else {
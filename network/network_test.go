@@ -0,0 +1,256 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// 记录写入的数据，用于生成发送的字节流
+type captureConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *captureConn) Write(b []byte) (int, error) {
+	return c.buf.Write(b)
+}
+
+type testFrame struct {
+	header, body string
+}
+
+// 使用WriteFrame将frames编码为字节流，compression不为空时压缩不小于compMin的帧
+func encodeFrames(t *testing.T, compression Compression, compMin int, frames []testFrame) []byte {
+	cc := &captureConn{}
+	w := NewConnByConn(cc)
+	if err := w.SetCompression(compression, compMin); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		if _, err := w.WriteFrame([]byte(f.header), []byte(f.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cc.buf.Bytes()
+}
+
+// 创建非阻塞的套接字对，返回读取端的Conn与写入端的fd
+func newFdPair(t *testing.T) (*Conn, int) {
+	p, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewConnByFd(p[0], make(chan struct{}, 1), make(chan int, 1))
+	t.Cleanup(func() {
+		_ = c.Close()
+		_ = unix.Close(p[1])
+	})
+	return c, p[1]
+}
+
+func writeAll(t *testing.T, fd int, b []byte) {
+	for len(b) > 0 {
+		n, err := unix.Write(fd, b)
+		if err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		b = b[n:]
+	}
+}
+
+// 读取缓冲区中所有完整的帧，直到数据不足或出错
+func readFrames(c *Conn) (frames []string, err error) {
+	for {
+		if err = c.NextFrame(); err != nil {
+			if err == unix.EAGAIN {
+				err = nil
+			}
+			return
+		}
+		frames = append(frames, string(c.frame))
+	}
+}
+
+func TestFrameSplit(t *testing.T) {
+	large := strings.Repeat("0123456789", 2*minReadSize/10+7) // 超过一次读取的缓冲区，需要扩容
+	compressible := strings.Repeat("a", 8192)
+
+	tests := []struct {
+		name        string
+		frames      []testFrame
+		compression Compression
+		compMin     int
+		maxHeader   int
+		maxBody     int
+		want        []string // 收到的帧，长度为0的帧被跳过
+		wantErr     error
+	}{
+		{
+			name:   "single",
+			frames: []testFrame{{"header", "body"}},
+			want:   []string{"headerbody"},
+		},
+		{
+			name:   "header only",
+			frames: []testFrame{{"option", ""}, {"h", "b"}},
+			want:   []string{"option", "hb"},
+		},
+		{
+			name:   "body only",
+			frames: []testFrame{{"", "body"}},
+			want:   []string{"body"},
+		},
+		{
+			name:   "zero length",
+			frames: []testFrame{{"", ""}, {"a", "b"}, {"", ""}, {"", ""}, {"c", "d"}, {"", ""}},
+			want:   []string{"ab", "cd"},
+		},
+		{
+			name:   "only zero length",
+			frames: []testFrame{{"", ""}, {"", ""}},
+		},
+		{
+			name:   "large",
+			frames: []testFrame{{"h", large}, {"x", "y"}},
+			want:   []string{"h" + large, "xy"},
+		},
+		{
+			name:        "gzip",
+			frames:      []testFrame{{"h1", compressible}, {"small", "frame"}, {"", ""}, {"h2", compressible}},
+			compression: CompressionGzip,
+			compMin:     64,
+			want:        []string{"h1" + compressible, "smallframe", "h2" + compressible},
+		},
+		{
+			name:        "flate",
+			frames:      []testFrame{{"h", compressible}, {"h", compressible}},
+			compression: CompressionFlate,
+			compMin:     64,
+			want:        []string{"h" + compressible, "h" + compressible},
+		},
+		{
+			name:      "at limit",
+			frames:    []testFrame{{"1234", "12345678"}},
+			maxHeader: 4,
+			maxBody:   8,
+			want:      []string{"123412345678"},
+		},
+		{
+			name:      "header too large",
+			frames:    []testFrame{{"ok", ""}, {"12345", "1"}},
+			maxHeader: 4,
+			maxBody:   8,
+			want:      []string{"ok"},
+			wantErr:   ErrFrameTooLarge,
+		},
+		{
+			name:      "body too large",
+			frames:    []testFrame{{"ok", ""}, {"1", "123456789"}},
+			maxHeader: 4,
+			maxBody:   8,
+			want:      []string{"ok"},
+			wantErr:   ErrFrameTooLarge,
+		},
+		{
+			name:        "compressed body too large",
+			frames:      []testFrame{{"h", strings.Repeat("a", 70)}},
+			compression: CompressionGzip,
+			compMin:     1,
+			maxHeader:   16,
+			maxBody:     64,
+			wantErr:     ErrFrameTooLarge,
+		},
+		{
+			name:        "decompressed frame too large",
+			frames:      []testFrame{{"h", compressible}},
+			compression: CompressionGzip,
+			compMin:     1,
+			maxHeader:   16,
+			maxBody:     64,
+			wantErr:     errDecompressTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := encodeFrames(t, tt.compression, tt.compMin, tt.frames)
+			// 在每个字节处拆分为两次到达
+			for split := 0; split <= len(stream); split++ {
+				c, w := newFdPair(t)
+				c.SetLimits(tt.maxHeader, tt.maxBody)
+				if err := c.SetCompression(tt.compression, tt.compMin); err != nil {
+					t.Fatal(err)
+				}
+
+				writeAll(t, w, stream[:split])
+				got, err := readFrames(c)
+				if err == nil {
+					writeAll(t, w, stream[split:])
+					var rest []string
+					rest, err = readFrames(c)
+					got = append(got, rest...)
+				}
+
+				if err != tt.wantErr {
+					t.Fatalf("split %d: err = %v, want %v", split, err, tt.wantErr)
+				}
+				if len(got) != len(tt.want) {
+					t.Fatalf("split %d: got %d frames, want %d", split, len(got), len(tt.want))
+				}
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Fatalf("split %d: frame %d = %.32q..., want %.32q...", split, i, got[i], tt.want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+// 超过限制的帧在收到首部时返回错误，不等待帧体
+func TestFrameLimitBeforeBody(t *testing.T) {
+	for _, tt := range []struct {
+		name               string
+		size, headerLen    uint32
+		maxHeader, maxBody int
+	}{
+		{"header", 100, 20, 16, 1024},
+		{"body", 100, 10, 16, 64},
+		{"header larger than frame", 10, 20, 32, 64},
+		{"compressed", 100 | frameCompressed, 10, 16, 64},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := newFdPair(t)
+			c.SetLimits(tt.maxHeader, tt.maxBody)
+			head := make([]byte, frameHeadLen)
+			binary.BigEndian.PutUint32(head, tt.size)
+			binary.BigEndian.PutUint32(head[4:], tt.headerLen)
+			writeAll(t, w, head)
+			if err := c.NextFrame(); err != ErrFrameTooLarge {
+				t.Fatalf("err = %v, want ErrFrameTooLarge", err)
+			}
+		})
+	}
+}
+
+// 对端关闭时返回错误，不会把半个帧交给序列化器
+func TestFramePeerClosed(t *testing.T) {
+	stream := encodeFrames(t, CompressionNone, 0, []testFrame{{"header", "body"}})
+	c, w := newFdPair(t)
+	writeAll(t, w, stream[:len(stream)-1])
+	if err := c.NextFrame(); err != unix.EAGAIN {
+		t.Fatalf("err = %v, want EAGAIN", err)
+	}
+	if _, ok := c.PartialSince(); !ok {
+		t.Fatal("partial frame not recorded")
+	}
+	_ = unix.Shutdown(w, unix.SHUT_WR)
+	if err := c.NextFrame(); err == nil || err == unix.EAGAIN {
+		t.Fatalf("err = %v after peer closed", err)
+	}
+}
@@ -0,0 +1,171 @@
+package network
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TLS 服务端在非阻塞的fd上使用crypto/tls
+// crypto/tls的握手无法在出错后继续，握手在单独的goroutine中完成：数据不足时重新监听可读事件，
+// 阻塞在channel上等待subReactor通知（不占用系统线程），握手超时由subReactor的时间轮关闭连接
+// 握手完成后数据不足时返回Temporary错误，crypto/tls遇到Temporary错误不会记录为连接错误，已读取的半个record保留在tls.Conn中，下次读取继续
+
+var errWouldBlock = &wouldBlockError{}
+
+// 非阻塞读取时数据还未到达
+type wouldBlockError struct{}
+
+func (e *wouldBlockError) Error() string   { return unix.EAGAIN.Error() }
+func (e *wouldBlockError) Timeout() bool   { return false }
+func (e *wouldBlockError) Temporary() bool { return true }
+
+// fdConn 将非阻塞的fd适配为net.Conn，供tls.Server使用
+type fdConn struct {
+	c *Conn
+}
+
+func (f *fdConn) Read(b []byte) (int, error) {
+	for {
+		n, err := unix.Read(f.c.Fd, b)
+		if n > 0 {
+			return n, nil
+		} else if n == 0 {
+			return 0, io.EOF
+		}
+		if err == unix.EINTR {
+			continue
+		}
+		if err != unix.EAGAIN {
+			return 0, err
+		}
+		if !f.c.HandshakePending() {
+			return 0, errWouldBlock
+		}
+		if err = f.c.waitReadable(); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// 握手阶段重新监听可读事件并等待subReactor通知，连接关闭（如握手超时）时返回错误
+func (c *Conn) waitReadable() error {
+	if err := c.armRead(); err != nil {
+		return err
+	}
+	select {
+	case <-c.readable:
+		return nil
+	case <-c.closed:
+		return errors.New("close")
+	}
+}
+
+func (f *fdConn) Write(b []byte) (int, error) {
+	return f.c.writeFd(b)
+}
+
+// Close 由network.Conn关闭fd
+func (f *fdConn) Close() error {
+	return nil
+}
+
+func (f *fdConn) LocalAddr() net.Addr {
+	sa, err := unix.Getsockname(f.c.Fd)
+	if err != nil {
+		return nil
+	}
+	return SockaddrToAddr(sa)
+}
+
+func (f *fdConn) RemoteAddr() net.Addr {
+	return f.c.RemoteAddr()
+}
+
+func (f *fdConn) SetDeadline(t time.Time) error      { return nil }
+func (f *fdConn) SetReadDeadline(t time.Time) error  { return nil }
+func (f *fdConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// UseTLS 服务端在连接上使用TLS，需要在读写之前调用Handshake完成握手
+// armRead用于握手阶段数据不足时重新监听fd的可读事件，事件到达后由NotifyReadable唤醒握手
+func (c *Conn) UseTLS(config *tls.Config, armRead func() error) {
+	c.raw = &fdConn{c: c}
+	c.tls = tls.Server(c.raw, config)
+	c.armRead = armRead
+	c.readable = make(chan struct{}, 1)
+	atomic.StoreInt32(&c.handshaking, 1)
+}
+
+// HandshakePending 是否需要先完成TLS握手
+func (c *Conn) HandshakePending() bool {
+	return atomic.LoadInt32(&c.handshaking) == 1
+}
+
+// HandshakeSince 握手未完成时返回连接建立的时间，用于计算握手超时
+func (c *Conn) HandshakeSince() (time.Time, bool) {
+	if !c.HandshakePending() {
+		return time.Time{}, false
+	}
+	return time.Unix(0, c.created), true
+}
+
+// NotifyReadable 握手未完成时唤醒等待可读的握手并返回true，此时可读事件不需要交给handlerRead池
+func (c *Conn) NotifyReadable() bool {
+	if !c.HandshakePending() {
+		return false
+	}
+	select {
+	case c.readable <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// Handshake 完成TLS握手，数据不足时等待NotifyReadable，连接关闭时返回错误
+// 握手完成后fd回到非阻塞读取
+func (c *Conn) Handshake() error {
+	if err := c.tls.Handshake(); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&c.handshaking, 0)
+	return nil
+}
+
+// TLSState 返回TLS连接状态，未使用TLS时返回nil
+func (c *Conn) TLSState() *tls.ConnectionState {
+	var tc *tls.Conn
+	if c.tls != nil {
+		tc = c.tls
+	} else if t, ok := c.conn.(*tls.Conn); ok {
+		tc = t
+	}
+	if tc == nil {
+		return nil
+	}
+	state := tc.ConnectionState()
+	return &state
+}
+
+// SockaddrToAddr 将accept返回的地址转换为net.Addr
+func SockaddrToAddr(sa unix.Sockaddr) net.Addr {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return &net.TCPAddr{IP: append(net.IP{}, sa.Addr[:]...), Port: sa.Port}
+	case *unix.SockaddrInet6:
+		addr := &net.TCPAddr{IP: append(net.IP{}, sa.Addr[:]...), Port: sa.Port}
+		if sa.ZoneId != 0 {
+			if ifi, err := net.InterfaceByIndex(int(sa.ZoneId)); err == nil {
+				addr.Zone = ifi.Name
+			}
+		}
+		return addr
+	case *unix.SockaddrUnix:
+		return &net.UnixAddr{Name: sa.Name, Net: "unix"}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+)
+
+// 连接对端的信息，服务端在收到协商报文后保存到连接的context中，方法通过请求的context获取
+
+// Peer 连接对端的信息
+type Peer struct {
+	Addr net.Addr             // 对端地址
+	TLS  *tls.ConnectionState // TLS连接状态，未使用TLS时为nil，双向认证时客户端证书见TLS.PeerCertificates
+}
+
+type peerKey struct{}
+
+// NewContext 将对端信息保存到context中
+func NewContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, p)
+}
+
+// FromContext 从context中获取对端信息
+func FromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(*Peer)
+	return p, ok
+}
@@ -0,0 +1,124 @@
+package reactor_test
+
+import (
+	"TinyRPC/client"
+	"TinyRPC/reactor"
+	"TinyRPC/server"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 启动Engine，测试结束时关闭，用于检查连接数
+func startEngine(t *testing.T, opts *reactor.ReactorOptions) (*reactor.Engine, string) {
+	addr := freeAddr(t)
+	s := server.New()
+	s.Register(new(Echo))
+	e, err := reactor.NewEngine(addr, s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = e.Run()
+	}()
+	t.Cleanup(func() {
+		_ = e.Close()
+	})
+	return e, addr
+}
+
+// 等待服务端的连接数变为n
+func waitConns(t *testing.T, e *reactor.Engine, n int) {
+	t.Helper()
+	for start := time.Now(); e.Conns() != n; time.Sleep(5 * time.Millisecond) {
+		if time.Since(start) > 2*time.Second {
+			t.Fatalf("conns = %d, want %d", e.Conns(), n)
+		}
+	}
+}
+
+func callEcho(t *testing.T, addr string) {
+	t.Helper()
+	c, err := client.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var reply string
+	if err = c.Call("Echo.Echo", "ping", &reply); err != nil || reply != "ping" {
+		t.Fatalf("Echo.Echo = %q, %v", reply, err)
+	}
+}
+
+// fd耗尽时服务端取出连接后立即关闭，客户端不会一直等待，fd恢复后继续正常accept
+func TestAcceptEMFILE(t *testing.T) {
+	e, addr := startEngine(t, nil)
+	callEcho(t, addr)
+	waitConns(t, e, 0) // 服务端关闭连接后才能确定空闲的fd
+
+	var old syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &old); err != nil {
+		t.Fatal(err)
+	}
+	ents, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip(err)
+	}
+	maxFd := 0
+	for _, ent := range ents {
+		if fd, _ := strconv.Atoi(ent.Name()); fd > maxFd {
+			maxFd = fd
+		}
+	}
+
+	// 限制fd数量并用/dev/null占满，只留一个空闲的fd给客户端的连接
+	limit := old
+	limit.Cur = uint64(maxFd + 16)
+	if err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	var fillers []int
+	restored := false
+	restore := func() {
+		if !restored {
+			restored = true
+			for _, fd := range fillers {
+				_ = syscall.Close(fd)
+			}
+			_ = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &old)
+		}
+	}
+	defer restore()
+	for {
+		fd, err := syscall.Open("/dev/null", syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			if err != syscall.EMFILE {
+				t.Fatal(err)
+			}
+			break
+		}
+		fillers = append(fillers, fd)
+	}
+	_ = syscall.Close(fillers[len(fillers)-1])
+	fillers = fillers[:len(fillers)-1]
+
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	restore()
+	if err == nil {
+		t.Fatal("read succeeded, want connection closed")
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("connection left in the accept queue while fds were exhausted")
+	}
+
+	callEcho(t, addr)
+}
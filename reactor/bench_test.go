@@ -0,0 +1,54 @@
+package reactor_test
+
+import (
+	"TinyRPC/client"
+	"TinyRPC/iomux"
+	"TinyRPC/reactor"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// 每个backend使用相同的负载：benchConns条连接并发调用，每条连接串行发起请求
+const benchConns = 256
+
+func benchmarkBackend(b *testing.B, backend iomux.Backend) {
+	addr := startServer(b, &reactor.ReactorOptions{IoBackend: backend})
+	time.Sleep(50 * time.Millisecond) // 等待Run启动reactor
+
+	parallelism := benchConns / runtime.GOMAXPROCS(0)
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	b.SetParallelism(parallelism)
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	b.RunParallel(func(pb *testing.PB) {
+		c, err := client.Dial("tcp", addr)
+		if err != nil {
+			b.Error(err)
+			return
+		}
+		defer c.Close()
+		var reply string
+		for pb.Next() {
+			if err = c.Call("Echo.Echo", "hello", &reply); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "req/s")
+}
+
+func BenchmarkEpoll(b *testing.B) {
+	benchmarkBackend(b, iomux.BackendEpoll)
+}
+
+func BenchmarkIoUring(b *testing.B) {
+	if err := iomux.IoUringSupported(); err != nil {
+		b.Skip("io_uring not supported: ", err)
+	}
+	benchmarkBackend(b, iomux.BackendIoUring)
+}
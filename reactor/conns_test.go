@@ -0,0 +1,83 @@
+package reactor_test
+
+import (
+	"TinyRPC/reactor"
+	"net"
+	"testing"
+	"time"
+)
+
+// 从本地地址localIP建立连接
+func dialFrom(t *testing.T, localIP, addr string) net.Conn {
+	t.Helper()
+	d := net.Dialer{Timeout: time.Second, LocalAddr: &net.TCPAddr{IP: net.ParseIP(localIP)}}
+	conn, err := d.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func TestMaxConns(t *testing.T) {
+	e, addr := startEngine(t, &reactor.ReactorOptions{MaxConns: 2})
+
+	held := []net.Conn{dialFrom(t, "127.0.0.1", addr), dialFrom(t, "127.0.0.2", addr)}
+	waitConns(t, e, 2)
+
+	// 超过连接数限制的连接被立即关闭，不占用计数
+	waitClosed(t, dialFrom(t, "127.0.0.3", addr), time.Second)
+	waitClosed(t, dialFrom(t, "127.0.0.1", addr), time.Second)
+	if n := e.Conns(); n != 2 {
+		t.Fatalf("conns = %d after rejecting, want 2", n)
+	}
+
+	// 连接关闭后释放计数，可以建立新的连接
+	_ = held[0].Close()
+	waitConns(t, e, 1)
+	callEcho(t, addr)
+	waitConns(t, e, 1)
+
+	_ = held[1].Close()
+	waitConns(t, e, 0)
+	dialFrom(t, "127.0.0.1", addr)
+	dialFrom(t, "127.0.0.1", addr)
+	waitConns(t, e, 2)
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	e, addr := startEngine(t, &reactor.ReactorOptions{MaxConnsPerIP: 2})
+
+	a1 := dialFrom(t, "127.0.0.1", addr)
+	dialFrom(t, "127.0.0.1", addr)
+	waitConns(t, e, 2)
+	waitClosed(t, dialFrom(t, "127.0.0.1", addr), time.Second)
+
+	// 其他IP不受影响
+	dialFrom(t, "127.0.0.2", addr)
+	dialFrom(t, "127.0.0.2", addr)
+	waitConns(t, e, 4)
+	waitClosed(t, dialFrom(t, "127.0.0.2", addr), time.Second)
+
+	// 释放一个连接后该IP可以再建立一个连接
+	_ = a1.Close()
+	waitConns(t, e, 3)
+	dialFrom(t, "127.0.0.1", addr)
+	waitConns(t, e, 4)
+	waitClosed(t, dialFrom(t, "127.0.0.1", addr), time.Second)
+}
+
+// 服务端主动关闭连接（空闲超时）时同样释放计数
+func TestMaxConnsReleaseOnServerClose(t *testing.T) {
+	e, addr := startEngine(t, &reactor.ReactorOptions{MaxConns: 1, MaxConnsPerIP: 1, IdleTimeout: 200 * time.Millisecond})
+
+	conn := dialFrom(t, "127.0.0.1", addr)
+	waitConns(t, e, 1)
+	waitClosed(t, dialFrom(t, "127.0.0.1", addr), time.Second)
+
+	waitClosed(t, conn, 3*time.Second)
+	waitConns(t, e, 0)
+	callEcho(t, addr)
+}
@@ -1,38 +1,63 @@
 package reactor
 
 import (
+	"TinyRPC/status"
 	"golang.org/x/sys/unix"
 	"time"
 )
 
 // handlerRead池，处理读事件
-func createHandlerRead(workerTask chan *WorkerTask, s Server, handlerReadTask chan []*HandlerReadTask) {
+func (e *Engine) createHandlerRead() {
+	s := e.s
 	for {
-		event := <-handlerReadTask
+		var event []*HandlerReadTask
+		select {
+		case event = <-e.handlerTask:
+		case <-e.done:
+			return
+		}
+
 		for i := 0; i < len(event); i++ {
 			var err error
 			var req *Request
 			t := event[i]
 
 			for {
-				// 序列化方式为空时，需要先确认序列化方式
-				if t.C == nil {
-					t.CMu.Lock()
+				// 正在关闭时不再读取新的请求，连接在关闭完成时统一关闭
+				if e.isClosing() {
+					break
+				}
+
+				// TLS握手由握手goroutine完成，完成后重新交给handlerRead池
+				if t.Conn.HandshakePending() {
+					break
+				}
+
+				// 缓冲区中有完整的帧才反序列化，数据未到齐时返回EAGAIN，已读取的数据保留在Conn中
+				if err = t.Conn.NextFrame(); err == nil {
+					// 序列化方式为空时，需要先确认序列化方式
 					if t.C == nil {
-						err = s.SelectCodec(t)
-					}
-					t.CMu.Unlock()
-				} else {
-					req, err = s.ServerCodec(t)          // 反序列化数据
-					if err == nil || req.H.Error != "" { // 没有报错或header.Error有错误信息都需要处理，header.Error不为空将直接发送给用户
-						handle := &WorkerTask{
-							Fd:           t.Fd,
-							C:            t.C,
-							Req:          req,
-							Sending:      &t.Sending,
-							SubReactorer: t.SubReactorer,
+						t.CMu.Lock()
+						if t.C == nil {
+							err = s.SelectCodec(t)
+						}
+						t.CMu.Unlock()
+					} else {
+						req, err = s.ServerCodec(t)          // 反序列化数据
+						if err == nil || req.H.Error != "" { // 没有报错或header.Error有错误信息都需要处理，header.Error不为空将直接发送给用户
+							handle := &WorkerTask{
+								Fd:           t.Fd,
+								C:            t.C,
+								Req:          req,
+								Sending:      &t.Sending,
+								SubReactorer: t.SubReactorer,
+								Conn:         t.Conn,
+							}
+							if !e.dispatchRead(handle) {
+								cancelRequest(req)
+								break
+							}
 						}
-						dispatchRead(handle, workerTask)
 					}
 				}
 
@@ -53,33 +78,100 @@ func createHandlerRead(workerTask chan *WorkerTask, s Server, handlerReadTask ch
 	}
 }
 
-// 读任务分发
-func dispatchRead(work *WorkerTask, workerTask chan *WorkerTask) {
-	workerTask <- work // 将反序列化好的数据发送给worker池执行业务逻辑
+// 完成TLS握手，数据不足时阻塞在channel上等待subReactor通知可读，超时由时间轮关闭连接
+// 握手期间客户端可能已发送协商报文，握手完成后直接交给handlerRead池读取
+func (e *Engine) handshake(t *HandlerReadTask) {
+	err := t.Conn.Handshake()
+	e.releaseHandshake()
+	if err != nil {
+		_ = t.SubReactorer.Remove(t.Fd)
+		return
+	}
+	select {
+	case e.handlerTask <- []*HandlerReadTask{t}:
+	case <-e.done:
+	}
+}
+
+// 读任务分发，正在关闭时丢弃任务并返回false
+func (e *Engine) dispatchRead(work *WorkerTask) bool {
+	e.mu.RLock()
+	if e.closing {
+		e.mu.RUnlock()
+		return false
+	}
+	e.inflight.Add(1) // 在发送响应后Done，关闭时等待inflight归零
+	e.mu.RUnlock()
+	work.Conn.AddInflight(1) // 有正在处理的请求时连接不会因空闲被关闭
+
+	if work.Req.H.Error == "" && e.sendWorker(work) { // 将反序列化好的数据发送给worker池执行业务逻辑
+		return true
+	}
+	if work.Req.H.Error == "" { // 过载，拒绝请求
+		e.s.RejectRequest(work.Req, status.New(status.Unavailable, "rpc server: overloaded, request shed"))
+	}
+	// 请求已有错误（如找不到服务、超过限流、过载），不占用worker，直接发送响应
+	e.sendWrite(work)
+	return true
+}
+
+// 将响应交给writer发送，已关闭时writer不再接收任务，释放请求占用的资源
+func (e *Engine) sendWrite(work *WorkerTask) {
+	select {
+	case e.handlerWriteTask <- work:
+	case <-e.done:
+		e.dropRequest(work)
+	}
+}
+
+// 释放已分发但不再发送响应的请求
+func (e *Engine) dropRequest(work *WorkerTask) {
+	cancelRequest(work.Req)
+	work.Conn.AddInflight(-1)
+	e.inflight.Done()
+}
+
+// 请求被丢弃时释放请求占用的资源
+func cancelRequest(req *Request) {
+	if req.Cancel != nil {
+		req.Cancel()
+	}
+	if req.Release != nil {
+		req.Release()
+	}
 }
 
 // 最大程度利用已有write goroutine，同时保证worker不阻塞
-func createHandlerWriterControl(s Server, handlerWriteTask chan *WorkerTask) {
+func (e *Engine) createHandlerWriterControl() {
 	writeTaskChan := make(chan *WorkerTask)
 	for {
-		write := <-handlerWriteTask
+		var write *WorkerTask
+		select {
+		case write = <-e.handlerWriteTask:
+		case <-e.done:
+			return
+		}
 	wait:
 		for {
 			select {
 			case writeTaskChan <- write:
 				break wait
+			case <-e.done: // writer已退出，不能再创建新的writer
+				e.dropRequest(write)
+				return
 			default:
-				go createHandlerWriter(s, writeTaskChan)
+				go e.createHandlerWriter(writeTaskChan)
 			}
 		}
 	}
 }
 
 // 实际执行write的goroutine，经过了duration没有收到任务退出goroutine
-func createHandlerWriter(s Server, handlerWriteTask chan *WorkerTask) {
+func (e *Engine) createHandlerWriter(handlerWriteTask chan *WorkerTask) {
 	var write *WorkerTask
-	duration := 60 * time.Second
+	duration := e.opts.WriterIdleTimeout
 	timer := time.NewTimer(duration)
+	defer timer.Stop()
 
 	for {
 		timer.Reset(duration)
@@ -87,13 +179,17 @@ func createHandlerWriter(s Server, handlerWriteTask chan *WorkerTask) {
 		case write = <-handlerWriteTask:
 		case <-timer.C:
 			return
+		case <-e.done:
+			return
 		}
 
 		write.Sending.Lock()
-		err := s.SendResponse(write)
+		err := e.s.SendResponse(write)
 		if err != nil { // 写错误
 			_ = write.SubReactorer.Remove(write.Fd)
 		}
 		write.Sending.Unlock()
+		write.Conn.AddInflight(-1)
+		e.inflight.Done()
 	}
 }
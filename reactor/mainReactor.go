@@ -2,86 +2,472 @@ package reactor
 
 import (
 	"TinyRPC/iomux"
+	"TinyRPC/network"
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"golang.org/x/sys/unix"
 	"net"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
+// ErrEngineClosed 调用Shutdown/Close后，Run返回此错误
+var ErrEngineClosed = errors.New("reactor: engine closed")
+
+// fd耗尽且没有预留的fd时暂停accept的时间
+const acceptBackoff = 10 * time.Millisecond
+
 type subReactor struct {
-	fd  chan int   // mainReactor向subReactor发送需要监听的fd
-	num int        // 当前subReactor监听的fd数量
-	mu  sync.Mutex // 保护num
+	fd    chan acceptedConn // mainReactor向subReactor发送需要监听的fd
+	num   int               // 当前subReactor监听的fd数量
+	mu    sync.Mutex        // 保护num，连接关闭时减少num
+	sub   *SubReactor       // subReactor实例，关闭时用于唤醒事件循环及关闭其监听的fd
+	ioMux iomux.IoMuX       // subReactor事件循环使用的ioMux实例
+}
+
+// mainReactor accept得到的连接
+type acceptedConn struct {
+	fd   int
+	addr net.Addr // 对端地址
+	ip   string   // 对端IP，用于统计每个IP的连接数
+}
+
+// Engine 记录mainReactor、subReactor、handler、worker的运行状态，用于关闭服务端
+type Engine struct {
+	s                Server
+	opts             *ReactorOptions         // reactor拓扑配置
+	fds              []int                   // 监听套接字，Acceptors大于1时每个acceptor一个
+	unixPath         string                  // 监听Unix域套接字时的路径，关闭时删除
+	waker            *iomux.Waker            // 唤醒mainReactor，使其停止accept
+	subReactors      []*subReactor           // 记录subReactor的信息
+	handlerTask      chan []*HandlerReadTask // subReactor向handlerRead池发送任务
+	workerTask       chan *WorkerTask        // handler向worker池发送任务
+	handlerWriteTask chan *WorkerTask        // worker池向handlerWriteControl发送响应任务
+	handshakes       int32                   // 正在进行的TLS握手数量，使用原子操作
+	shedder          *shedder                // 过载保护，未开启时为nil
+
+	connMu  sync.Mutex     // 保护conns、ipConns
+	conns   int            // 当前连接数
+	ipConns map[string]int // 每个客户端IP的当前连接数
+
+	mu       sync.RWMutex   // 保护running、closing
+	running  bool           // Run已被调用
+	closing  bool           // 已开始关闭，不再接收新的请求
+	inflight sync.WaitGroup // 已分发给worker池但还未发送响应的请求
+	stopped  chan struct{}  // mainReactor已退出
+	done     chan struct{}  // 通知handler、worker、subReactor退出
+	loops    sync.WaitGroup // subReactor事件循环
+	release  sync.Once
 }
 
 // Reactor 对外接口，负责启动mainReactor、subReactor、handler、worker
 func Reactor(addr string, s Server) error {
+	e, err := NewEngine(addr, s, nil)
+	if err != nil {
+		return err
+	}
+	return e.Run()
+}
+
+// NewEngine 创建监听套接字，需要调用Run启动。opts为nil时使用DefaultReactorOptions
+// addr以"unix://"开头时监听Unix域套接字，如"unix:///run/app.sock"，否则监听TCP地址
+func NewEngine(addr string, s Server, opts *ReactorOptions) (*Engine, error) {
+	opt := parseReactorOptions(opts)
+	opt.IoBackend = iomux.Resolve(opt.IoBackend) // 内核不支持io_uring时使用epoll
 	var (
-		subReactors      []*subReactor                   // 记录subReactor的信息
-		handlerTask      = make(chan []*HandlerReadTask) // subReactor向handlerRead池发送任务
-		workerTask       = make(chan *WorkerTask)        // handler向worker池发送任务
-		handlerWriteTask = make(chan *WorkerTask)        // worker池向handlerWriteControl发送响应任务
+		fds      []int
+		unixPath string
+		err      error
 	)
-
-	fd, err := createTCPSocket(addr)
+	if strings.HasPrefix(addr, UnixScheme) { // Unix域套接字只使用一个acceptor
+		unixPath = strings.TrimPrefix(addr, UnixScheme)
+		var fd int
+		if fd, err = createUnixSocket(unixPath, opt.UnixSocketMode); err == nil {
+			fds = []int{fd}
+		}
+	} else {
+		fds, err = createTCPSockets(addr, opt.Acceptors, opt.IPv6Only)
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+	waker, err := iomux.NewWaker()
+	if err != nil {
+		for _, fd := range fds {
+			_ = unix.Close(fd)
+		}
+		if unixPath != "" {
+			_ = os.Remove(unixPath)
+		}
+		return nil, err
 	}
 
+	e := &Engine{
+		s:                s,
+		opts:             opt,
+		fds:              fds,
+		unixPath:         unixPath,
+		waker:            waker,
+		handlerTask:      make(chan []*HandlerReadTask),
+		workerTask:       make(chan *WorkerTask),
+		handlerWriteTask: make(chan *WorkerTask),
+		stopped:          make(chan struct{}),
+		done:             make(chan struct{}),
+		ipConns:          make(map[string]int),
+	}
+	if e.opts.ShedTarget > 0 {
+		e.shedder = newShedder(e.opts.ShedTarget, e.opts.ShedInterval)
+		e.workerTask = make(chan *WorkerTask, e.opts.WorkerNum) // 排队的请求才能统计排队时间
+	}
+	return e, nil
+}
+
+// Run 启动mainReactor、subReactor、handler、worker，阻塞直到关闭或出现错误
+func (e *Engine) Run() error {
+	e.mu.Lock()
+	if e.closing || e.running {
+		e.mu.Unlock()
+		return ErrEngineClosed
+	}
+	e.running = true
+	e.mu.Unlock()
+	defer close(e.stopped)
+
 	// 启动Worker池
-	for i := 0; i < 500; i++ {
-		go createWorker(workerTask, s, handlerWriteTask)
+	for i := 0; i < e.opts.WorkerNum; i++ {
+		go e.createWorker()
 	}
 
 	// 启动Handler池
-	for i := 0; i < 10; i++ {
-		go createHandlerRead(workerTask, s, handlerTask) // read池
+	for i := 0; i < e.opts.HandlerNum; i++ {
+		go e.createHandlerRead() // read池
 	}
-	go createHandlerWriterControl(s, handlerWriteTask) // writeControl
+	go e.createHandlerWriterControl() // writeControl
 
 	// 启动SubReactor
-	for i := 0; i < 10; i++ {
-		subReactors = append(subReactors, &subReactor{
-			fd: make(chan int),
+	for i := 0; i < e.opts.SubReactorNum; i++ {
+		sub, ioMux, err := newSubReactor(e.opts.IoBackend, e.opts.EventBatch)
+		if err != nil {
+			e.mu.Lock()
+			e.closing = true
+			e.mu.Unlock()
+			e.closeListener()
+			e.stop()
+			return err
+		}
+		if e.opts.IdleTimeout > 0 || e.opts.ReadTimeout > 0 || e.opts.TLSConfig != nil {
+			sub.wheel = newTimingWheel()
+		}
+		e.subReactors = append(e.subReactors, &subReactor{
+			fd:    make(chan acceptedConn),
+			sub:   sub,
+			ioMux: ioMux,
 		})
-		go createSubReactor(subReactors[i].fd, handlerTask)
+		e.loops.Add(1)
+		go e.createSubReactor(e.subReactors[i])
 	}
 
 	// 启动mainReactor
-	return mainReactor(fd, subReactors)
+	err := e.runAcceptors()
+	e.closeListener()
+
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		return ErrEngineClosed
+	}
+	e.closing = true
+	e.mu.Unlock()
+	e.stop()
+	return err
+}
+
+// Shutdown 优雅关闭：停止accept、不再读取新请求，等待已分发的请求处理完成并发送响应后，关闭所有连接
+// ctx超时后不再等待，直接关闭所有连接并返回ctx.Err()
+func (e *Engine) Shutdown(ctx context.Context) error {
+	return e.shutdown(ctx, true)
+}
+
+// Close 立即关闭，不等待正在处理的请求
+func (e *Engine) Close() error {
+	return e.shutdown(context.Background(), false)
+}
+
+func (e *Engine) shutdown(ctx context.Context, drain bool) (err error) {
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		return ErrEngineClosed
+	}
+	e.closing = true
+	running := e.running
+	e.mu.Unlock()
+
+	if !running { // 未调用Run，只需要释放资源
+		e.closeListener()
+		e.stop()
+		return nil
+	}
+
+	// 停止accept
+	_ = e.waker.Wake()
+	<-e.stopped
+
+	// 等待已分发的请求发送响应
+	if drain {
+		drained := make(chan struct{})
+		go func() {
+			e.inflight.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	e.stop()
+	return
+}
+
+// 正在进行的TLS握手未超过MaxHandshakes时计数并返回true
+func (e *Engine) acquireHandshake() bool {
+	if atomic.AddInt32(&e.handshakes, 1) > int32(e.opts.MaxHandshakes) {
+		atomic.AddInt32(&e.handshakes, -1)
+		return false
+	}
+	return true
+}
+
+// 握手结束时释放计数
+func (e *Engine) releaseHandshake() {
+	atomic.AddInt32(&e.handshakes, -1)
+}
+
+// 判断是否正在关闭，handlerRead在关闭时不再分发新的请求
+func (e *Engine) isClosing() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.closing
+}
+
+// 关闭监听套接字，mainReactor退出后调用，监听Unix域套接字时删除套接字文件
+// waker在stop中关闭，Run出错返回时并发调用的Shutdown可能还在唤醒mainReactor，提前关闭会写入被复用的fd
+func (e *Engine) closeListener() {
+	if e.fds != nil {
+		for _, fd := range e.fds {
+			_ = unix.Close(fd)
+		}
+		e.fds = nil
+		if e.unixPath != "" {
+			_ = os.Remove(e.unixPath)
+		}
+	}
+}
+
+// 通知所有goroutine退出，等待subReactor事件循环退出后关闭其监听的所有连接及waker
+func (e *Engine) stop() {
+	e.release.Do(func() {
+		close(e.done)
+		for _, sr := range e.subReactors {
+			sr.sub.wakeup()
+		}
+		e.loops.Wait()
+		for _, sr := range e.subReactors {
+			sr.sub.closeAll()
+		}
+		_ = e.waker.Close()
+		// 开启过载保护时workerTask有缓冲，worker退出后释放还在排队的请求
+		for {
+			select {
+			case work := <-e.workerTask:
+				e.dropRequest(work)
+			default:
+				return
+			}
+		}
+	})
 }
 
-func createTCPSocket(addr string) (fd int, err error) {
+// 创建n个非阻塞的监听套接字，addr可以是IPv4、IPv6地址或主机名，主机为空（如":9991"）时监听所有网卡
+// IPv6地址默认同时接收IPv4连接，ipv6Only为true时只接收IPv6连接
+// n大于1时设置SO_REUSEPORT，多个套接字绑定同一地址，由内核将新连接分配给各个套接字
+func createTCPSockets(addr string, n int, ipv6Only bool) (fds []int, err error) {
+	// 获取TCPAddr，主机名解析为第一个地址
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+			fds = nil
+			err = &net.OpError{Op: "listen", Net: "tcp", Addr: tcpAddr, Err: err}
+		}
+	}()
+
+	family, sa := tcpSockaddr(tcpAddr)
+	for i := 0; i < n; i++ {
+		fd, err := newSocket(family, unix.IPPROTO_TCP)
+		if err != nil && i == 0 && family == unix.AF_INET6 && tcpAddr.IP == nil { // 内核不支持IPv6时只监听IPv4
+			family, sa = unix.AF_INET, &unix.SockaddrInet4{Port: tcpAddr.Port}
+			fd, err = newSocket(family, unix.IPPROTO_TCP)
+		}
+		if err != nil {
+			return fds, os.NewSyscallError("socket", err)
+		}
+		fds = append(fds, fd)
+
+		if err = listenSocket(fd, family, sa, ipv6Only, n > 1); err != nil {
+			return fds, err
+		}
+		if i == 0 && tcpAddr.Port == 0 && n > 1 { // 端口为0时其余套接字绑定第一个套接字分配到的端口
+			if sa, err = unix.Getsockname(fd); err != nil {
+				return fds, os.NewSyscallError("getsockname", err)
+			}
+		}
+	}
+	return fds, nil
+}
+
+// UnixScheme Unix域套接字地址的前缀
+const UnixScheme = "unix://"
+
+// 创建非阻塞的Unix域套接字并监听path，path上遗留的套接字文件没有进程监听时删除
+// mode不为0时修改套接字文件的权限，客户端需要有写权限才能连接
+func createUnixSocket(path string, mode os.FileMode) (fd int, err error) {
+	addr := &net.UnixAddr{Name: path, Net: "unix"}
+	if err = removeStaleSocket(path); err != nil {
+		return -1, &net.OpError{Op: "listen", Net: "unix", Addr: addr, Err: err}
+	}
+	if fd, err = newSocket(unix.AF_UNIX, 0); err != nil {
+		return -1, &net.OpError{Op: "listen", Net: "unix", Addr: addr, Err: os.NewSyscallError("socket", err)}
+	}
+
+	if err = unix.Bind(fd, &unix.SockaddrUnix{Name: path}); err != nil {
+		_ = unix.Close(fd)
+		return -1, &net.OpError{Op: "listen", Net: "unix", Addr: addr, Err: os.NewSyscallError("bind", err)}
+	}
+	// 套接字文件已创建，之后出错时需要删除
+	if mode != 0 {
+		err = os.Chmod(path, mode)
+	}
+	if err == nil {
+		if err = unix.Listen(fd, maxListenerBacklog()); err != nil {
+			err = os.NewSyscallError("listen", err)
+		}
+	}
+	if err != nil {
+		_ = unix.Close(fd)
+		_ = os.Remove(path)
+		return -1, &net.OpError{Op: "listen", Net: "unix", Addr: addr, Err: err}
+	}
+	return fd, nil
+}
+
+// 删除没有进程监听的套接字文件，服务端异常退出时套接字文件不会被删除
+// path不是套接字文件或仍有进程监听时返回错误
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return unix.EADDRINUSE
+	}
+	if !errors.Is(err, unix.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// 创建非阻塞的套接字，proto为0时使用地址族默认的协议
+func newSocket(family, proto int) (fd int, err error) {
 	// unix.CloseOnExec(fd)和RLock为了在Fork子进程时，关闭子进程文件描述符，防止子进程监听文件描述符。
 	syscall.ForkLock.RLock()
-	//                         TCP/IP–IPv4      流套接字           TCP协议
-	if fd, err = unix.Socket(unix.AF_INET, unix.SOCK_STREAM, unix.IPPROTO_TCP); err == nil {
+	//                         地址族   流套接字           协议
+	if fd, err = unix.Socket(family, unix.SOCK_STREAM, proto); err == nil {
 		unix.CloseOnExec(fd)
 	}
 	syscall.ForkLock.RUnlock()
 	if err != nil {
-		return
+		return -1, err
 	}
 
 	// 设置非阻塞模式
 	if err = unix.SetNonblock(fd, true); err != nil {
 		_ = unix.Close(fd)
-		return fd, err
+		return -1, err
 	}
+	return fd, nil
+}
 
-	// 获取TCPAddr
-	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
-	sa := unix.SockaddrInet4{Port: tcpAddr.Port}
-	copy(sa.Addr[:], tcpAddr.IP)
+// 设置套接字选项，绑定地址并开始监听，reusePort为true时设置SO_REUSEPORT
+func listenSocket(fd, family int, sa unix.Sockaddr, ipv6Only, reusePort bool) error {
+	// 重启时可以立即绑定仍有TIME_WAIT连接的端口
+	if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	if reusePort {
+		if err := unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	if family == unix.AF_INET6 {
+		v6only := 0
+		if ipv6Only {
+			v6only = 1
+		}
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, v6only); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
 
 	// 绑定IP和端口
-	_ = unix.Bind(fd, &sa)
-	err = unix.Listen(fd, maxListenerBacklog())
-	return
+	if err := unix.Bind(fd, sa); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+	if err := unix.Listen(fd, maxListenerBacklog()); err != nil {
+		return os.NewSyscallError("listen", err)
+	}
+	return nil
+}
+
+// 根据地址选择地址族，IPv4地址使用AF_INET，IPv6地址及未指定地址使用AF_INET6
+func tcpSockaddr(addr *net.TCPAddr) (int, unix.Sockaddr) {
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		sa := &unix.SockaddrInet4{Port: addr.Port}
+		copy(sa.Addr[:], ip4)
+		return unix.AF_INET, sa
+	}
+
+	sa := &unix.SockaddrInet6{Port: addr.Port}
+	copy(sa.Addr[:], addr.IP) // IP为nil时为全零地址，监听所有网卡
+	if addr.Zone != "" {
+		if ifi, err := net.InterfaceByName(addr.Zone); err == nil {
+			sa.ZoneId = uint32(ifi.Index)
+		}
+	}
+	return unix.AF_INET6, sa
 }
 
 // 全连接队列大小，min(此处返回的值,内核somaxconn)，err为nil时，此处返回的值就是内核somaxconn的值
@@ -119,12 +505,40 @@ func maxListenerBacklog() int {
 	return n
 }
 
-// 主Reactor，监听accept事件
-func mainReactor(fd int, subReactors []*subReactor) error {
-	ioMux, err := iomux.NewEpoll(1)
+// 启动mainReactor，每个监听套接字一个accept循环，任一循环出错时唤醒其余循环退出
+func (e *Engine) runAcceptors() (err error) {
+	errs := make(chan error, len(e.fds))
+	for _, fd := range e.fds {
+		go func(fd int) {
+			err := e.mainReactor(fd)
+			if err != nil {
+				_ = e.waker.Wake()
+			}
+			errs <- err
+		}(fd)
+	}
+	for range e.fds {
+		if aerr := <-errs; aerr != nil && err == nil {
+			err = aerr
+		}
+	}
+	return
+}
+
+// 主Reactor，监听fd的accept事件，收到waker的唤醒后退出
+func (e *Engine) mainReactor(fd int) error {
+	ioMux, err := iomux.New(e.opts.IoBackend, 2)
 	if err != nil {
 		return err
 	}
+	defer ioMux.Close()
+
+	spare := openSpareFd()
+	defer func() {
+		if spare >= 0 {
+			_ = unix.Close(spare)
+		}
+	}()
 
 	var event unix.EpollEvent
 	event.Fd = int32(fd)
@@ -132,18 +546,52 @@ func mainReactor(fd int, subReactors []*subReactor) error {
 	if err := ioMux.Add(fd, event); err != nil {
 		return err
 	}
+	event.Fd = int32(e.waker.Fd)
+	if err := ioMux.Add(e.waker.Fd, event); err != nil {
+		return err
+	}
 
 	for {
-		_, err := ioMux.Wait()
+		nevents, err := ioMux.Wait(-1)
 		if err != nil && err != unix.EINTR {
 			return err
 		}
-		connfd, _, err := unix.Accept(fd)
+		for ev := 0; ev < nevents; ev++ {
+			if int(ioMux.Event(ev).Fd) == e.waker.Fd {
+				return nil
+			}
+		}
+		e.accept(fd, &spare)
+	}
+}
+
+// 循环accept直到全连接队列为空（EAGAIN），减少重连高峰时epoll_wait的次数
+// spare为预留的fd，fd耗尽时用于取出并关闭连接
+func (e *Engine) accept(fd int, spare *int) {
+	subReactors := e.subReactors
+	for {
+		// 新连接直接设置为非阻塞模式及close-on-exec
+		connfd, sa, err := unix.Accept4(fd, unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
 		if err != nil {
-			continue
+			if err == unix.EINTR || err == unix.ECONNABORTED { // 连接在accept前被客户端关闭
+				continue
+			}
+			if err == unix.EMFILE || err == unix.ENFILE {
+				// fd耗尽时连接留在全连接队列中，水平触发的监听套接字一直可读，mainReactor会空转
+				// 释放预留的fd取出一个连接后立即关闭，客户端收到连接关闭而不是一直等待，没有预留的fd时暂停accept
+				if !shedConn(fd, spare) {
+					time.Sleep(acceptBackoff)
+				}
+			}
+			return // EAGAIN，等待下次事件
 		}
-		// 设置非阻塞模式
-		if err = unix.SetNonblock(connfd, true); err != nil {
+		// 超过连接数限制时立即关闭，不交给subReactor
+		addr := network.SockaddrToAddr(sa)
+		var ip string
+		if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+			ip = tcpAddr.IP.String()
+		}
+		if !e.acquireConn(ip) {
 			_ = unix.Close(connfd)
 			continue
 		}
@@ -158,6 +606,67 @@ func mainReactor(fd int, subReactors []*subReactor) error {
 		subReactors[min].mu.Lock()
 		subReactors[min].num++
 		subReactors[min].mu.Unlock()
-		subReactors[min].fd <- connfd // 将连接的读写事件交给subReactor处理
+		subReactors[min].fd <- acceptedConn{fd: connfd, addr: addr, ip: ip} // 将连接的读写事件交给subReactor处理
 	}
 }
+
+// 打开一个预留的fd，失败时返回-1
+func openSpareFd() int {
+	fd, err := unix.Open("/dev/null", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1
+	}
+	return fd
+}
+
+// fd耗尽时关闭预留的fd，取出一个连接并关闭后重新预留，没有预留的fd时尝试重新预留并返回false
+func shedConn(fd int, spare *int) bool {
+	if *spare < 0 {
+		*spare = openSpareFd()
+		return false
+	}
+	_ = unix.Close(*spare)
+	if connfd, _, err := unix.Accept4(fd, unix.SOCK_CLOEXEC); err == nil {
+		_ = unix.Close(connfd)
+	}
+	*spare = openSpareFd()
+	return true
+}
+
+// 连接数未超过MaxConns、MaxConnsPerIP时计数并返回true
+func (e *Engine) acquireConn(ip string) bool {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+
+	if e.opts.MaxConns > 0 && e.conns >= e.opts.MaxConns {
+		return false
+	}
+	if e.opts.MaxConnsPerIP > 0 && ip != "" && e.ipConns[ip] >= e.opts.MaxConnsPerIP {
+		return false
+	}
+	e.conns++
+	if ip != "" {
+		e.ipConns[ip]++
+	}
+	return true
+}
+
+// 连接关闭时释放计数
+func (e *Engine) releaseConn(ip string) {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+
+	e.conns--
+	if ip != "" {
+		if e.ipConns[ip]--; e.ipConns[ip] <= 0 {
+			delete(e.ipConns, ip)
+		}
+	}
+}
+
+// Conns 返回当前的连接数
+func (e *Engine) Conns() int {
+	e.connMu.Lock()
+	defer e.connMu.Unlock()
+	return e.conns
+}
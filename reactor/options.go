@@ -0,0 +1,97 @@
+package reactor
+
+import (
+	"TinyRPC/iomux"
+	"TinyRPC/network"
+	"crypto/tls"
+	"os"
+	"runtime"
+	"time"
+)
+
+// ReactorOptions reactor的拓扑配置，字段为零值时使用默认值
+type ReactorOptions struct {
+	WorkerNum         int           // worker池goroutine数量，默认值：CPU核数*64
+	HandlerNum        int           // handlerRead池goroutine数量，默认值：CPU核数
+	SubReactorNum     int           // subReactor数量，默认值：CPU核数
+	EventBatch        int           // subReactor每次epoll_wait最多返回的事件数，默认值：5120
+	IoBackend         iomux.Backend // 事件通知的实现，iomux.BackendEpoll或iomux.BackendIoUring，内核不支持io_uring时使用epoll，默认值：epoll
+	WriterIdleTimeout time.Duration // write goroutine空闲超过该时间后退出，默认值：60s
+	TLSConfig         *tls.Config   // 不为nil时连接使用TLS，需要验证客户端证书时设置ClientAuth和ClientCAs
+	HandshakeTimeout  time.Duration // TLS握手超时时间，默认值：10s
+	MaxHandshakes     int           // 同时进行的TLS握手数量上限，每个未完成的握手占用一个等待subReactor通知可读的goroutine，超过时accept后立即关闭新连接，默认值：1024
+	ShedTarget        time.Duration // 开启过载保护，请求排队时间持续超过该值时拒绝新的请求，0表示不开启
+	ShedInterval      time.Duration // 过载保护统计排队时间的周期，默认值：100ms
+	IdleTimeout       time.Duration // 连接没有收发数据且没有正在处理的请求超过该时间后关闭，0表示不关闭
+	ReadTimeout       time.Duration // 从收到帧的第一个字节（新连接从建立开始）到收到完整帧的最长时间，超时关闭连接，0表示不限制
+	MaxHeaderSize     int           // 请求header的最大长度，超过时关闭连接，默认值：network.DefaultMaxHeaderSize
+	MaxBodySize       int           // 请求body的最大长度，超过时关闭连接，默认值：network.DefaultMaxBodySize
+	MaxConns          int           // 最大连接数，超过时accept后立即关闭新连接，0表示不限制
+	MaxConnsPerIP     int           // 每个客户端IP的最大连接数，超过时accept后立即关闭新连接，0表示不限制
+	IPv6Only          bool          // 监听IPv6地址或未指定主机时只接收IPv6连接，默认同时接收IPv4连接
+	UnixSocketMode    os.FileMode   // 监听Unix域套接字时套接字文件的权限，如0660，0表示不修改（由umask决定）
+	Acceptors         int           // 监听套接字及accept循环的数量，大于1时使用SO_REUSEPORT，Unix域套接字固定为1，默认值：1
+}
+
+// DefaultReactorOptions 根据CPU核数返回默认配置
+func DefaultReactorOptions() *ReactorOptions {
+	n := runtime.NumCPU()
+	return &ReactorOptions{
+		WorkerNum:         n * 64,
+		HandlerNum:        n,
+		SubReactorNum:     n,
+		EventBatch:        5120,
+		IoBackend:         iomux.BackendEpoll,
+		WriterIdleTimeout: 60 * time.Second,
+		HandshakeTimeout:  10 * time.Second,
+		MaxHandshakes:     1024,
+		ShedInterval:      100 * time.Millisecond,
+		Acceptors:         1,
+		MaxHeaderSize:     network.DefaultMaxHeaderSize,
+		MaxBodySize:       network.DefaultMaxBodySize,
+	}
+}
+
+// 使用默认值填充未设置的字段，不修改调用方传入的配置
+func parseReactorOptions(opts *ReactorOptions) *ReactorOptions {
+	def := DefaultReactorOptions()
+	if opts == nil {
+		return def
+	}
+
+	opt := *opts
+	if opt.WorkerNum <= 0 {
+		opt.WorkerNum = def.WorkerNum
+	}
+	if opt.HandlerNum <= 0 {
+		opt.HandlerNum = def.HandlerNum
+	}
+	if opt.SubReactorNum <= 0 {
+		opt.SubReactorNum = def.SubReactorNum
+	}
+	if opt.EventBatch <= 0 {
+		opt.EventBatch = def.EventBatch
+	}
+	if opt.WriterIdleTimeout <= 0 {
+		opt.WriterIdleTimeout = def.WriterIdleTimeout
+	}
+	if opt.HandshakeTimeout <= 0 {
+		opt.HandshakeTimeout = def.HandshakeTimeout
+	}
+	if opt.MaxHandshakes <= 0 {
+		opt.MaxHandshakes = def.MaxHandshakes
+	}
+	if opt.ShedInterval <= 0 {
+		opt.ShedInterval = def.ShedInterval
+	}
+	if opt.Acceptors <= 0 {
+		opt.Acceptors = def.Acceptors
+	}
+	if opt.MaxHeaderSize <= 0 {
+		opt.MaxHeaderSize = def.MaxHeaderSize
+	}
+	if opt.MaxBodySize <= 0 {
+		opt.MaxBodySize = def.MaxBodySize
+	}
+	return &opt
+}
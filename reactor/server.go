@@ -3,18 +3,22 @@ package reactor
 import (
 	"TinyRPC/codec"
 	"TinyRPC/network"
+	"context"
 	"reflect"
 	"sync"
+	"time"
 )
 
 // HandlerReadTask subReactor发送任务给handlerRead池，同时也用于server.SelectCodec和server.ServerCodec方法反序列化数据
 type HandlerReadTask struct {
 	Fd           int
-	Conn         *network.Conn // 读取协商报文
-	C            codec.Codec   // 序列化报文
-	CMu          sync.Mutex    // 确保codec不会重复确认导致错误
-	Sending      sync.Mutex    // 确保同一连接send操作串行
-	SubReactorer *SubReactor   // subReactor实例，用于操作epoll监听的事件
+	Ctx          context.Context    // 连接的context，连接被移除时取消，请求的context由此派生
+	Cancel       context.CancelFunc // 取消连接的context
+	Conn         *network.Conn      // 按帧读取数据，收到完整的帧后才反序列化
+	C            codec.Codec        // 序列化报文
+	CMu          sync.Mutex         // 确保codec不会重复确认导致错误
+	Sending      sync.Mutex         // 确保同一连接send操作串行
+	SubReactorer *SubReactor        // subReactor实例，用于操作epoll监听的事件
 }
 
 // WorkerTask handlerRead池发送任务给worker池，同时用于server.HandleRequest方法处理业务逻辑
@@ -25,11 +29,16 @@ type WorkerTask struct {
 	Req          *Request
 	Sending      *sync.Mutex // 确保同一连接send操作串行
 	SubReactorer *SubReactor // subReactor实例，用于操作epoll监听的事件
+	Enqueued     time.Time   // 交给worker池的时间，开启过载保护时用于统计排队时间
+	Conn         *network.Conn
 }
 
 // Request 反序列化数据结果，返回给handlerRead，用于worker处理业务逻辑
 type Request struct {
 	H            *codec.Header
+	Ctx          context.Context    // 请求的context，超过Header.Timeout或连接被移除时取消
+	Cancel       context.CancelFunc // 发送响应后释放context
+	Release      func()             // 发送响应后释放限流占用的并发数，为nil时不需要释放
 	S            *Service
 	Mtype        *MethodType
 	Argv, Replyv reflect.Value
@@ -47,6 +56,7 @@ type Service struct {
 // MethodType 注册的结构体中的方法
 type MethodType struct {
 	Method    reflect.Method
+	HasCtx    bool // 方法的第一个参数为context.Context
 	ArgType   reflect.Type
 	ReplyType reflect.Type
 }
@@ -54,6 +64,7 @@ type MethodType struct {
 type Server interface {
 	SelectCodec(t *HandlerReadTask) error
 	ServerCodec(t *HandlerReadTask) (req *Request, err error)
-	HandleRequest(handle *WorkerTask, handlerWriteTask chan *WorkerTask)
+	HandleRequest(handle *WorkerTask) // 执行业务逻辑，结果写入handle.Req，由reactor发送响应
 	SendResponse(handle *WorkerTask) (err error)
+	RejectRequest(req *Request, err error) // 将err作为请求的错误信息，不调用方法直接发送给客户端
 }
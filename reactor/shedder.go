@@ -0,0 +1,89 @@
+package reactor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 自适应过载保护（CoDel），统计请求从dispatchRead到worker开始处理的排队时间
+// 开启后workerTask带缓冲（长度为WorkerNum），请求在缓冲中排队，排队时间才能反映worker池的负载
+// 一个统计周期内的最小排队时间超过目标值时认为过载，过载期间队列不为空时直接拒绝新的请求，不再排队
+// 排队时间取周期内的最小值，短暂的突发不会触发过载
+
+type shedder struct {
+	target   time.Duration // 排队时间目标值
+	interval time.Duration // 统计周期
+
+	mu        sync.Mutex    // 保护windowEnd、minDelay
+	windowEnd time.Time     // 当前统计周期的结束时间
+	minDelay  time.Duration // 当前统计周期内的最小排队时间，-1表示还没有统计
+
+	overloaded int32  // 上一个统计周期是否过载
+	shed       uint64 // 被拒绝的请求数
+}
+
+func newShedder(target, interval time.Duration) *shedder {
+	return &shedder{
+		target:    target,
+		interval:  interval,
+		windowEnd: time.Now().Add(interval),
+		minDelay:  -1,
+	}
+}
+
+// worker开始处理请求时记录排队时间
+func (s *shedder) observe(delay time.Duration) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.minDelay < 0 || delay < s.minDelay {
+		s.minDelay = delay
+	}
+	if now.After(s.windowEnd) {
+		var overloaded int32
+		if s.minDelay > s.target {
+			overloaded = 1
+		}
+		atomic.StoreInt32(&s.overloaded, overloaded)
+		s.windowEnd = now.Add(s.interval)
+		s.minDelay = -1
+	}
+}
+
+func (s *shedder) isOverloaded() bool {
+	return atomic.LoadInt32(&s.overloaded) == 1
+}
+
+// 将请求交给worker池，过载且队列不为空时返回false，已关闭时释放请求并返回true
+func (e *Engine) sendWorker(work *WorkerTask) bool {
+	if e.shedder != nil {
+		work.Enqueued = time.Now()
+	}
+	if e.shedder == nil || !e.shedder.isOverloaded() {
+		select {
+		case e.workerTask <- work:
+		case <-e.done: // worker已退出，请求不会再被处理
+			e.dropRequest(work)
+		}
+		return true
+	}
+	if len(e.workerTask) == 0 {
+		select {
+		case e.workerTask <- work:
+			return true
+		default:
+		}
+	}
+	atomic.AddUint64(&e.shedder.shed, 1)
+	return false
+}
+
+// Shed 返回因过载被拒绝的请求数
+func (e *Engine) Shed() uint64 {
+	if e.shedder == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&e.shedder.shed)
+}
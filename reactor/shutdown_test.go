@@ -0,0 +1,129 @@
+package reactor_test
+
+import (
+	"TinyRPC/client"
+	"TinyRPC/server"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// Block 方法在release关闭前阻塞，用于测试关闭时正在处理的请求
+type Block struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *Block) Wait(args int, reply *int) error {
+	b.started <- struct{}{}
+	<-b.release
+	*reply = args
+	return nil
+}
+
+// 启动注册了Block服务的服务端，返回地址及Run的返回值
+func startBlockServer(t *testing.T, b *Block) (*server.Server, string, chan error) {
+	addr := freeAddr(t)
+	s := server.New()
+	s.Register(b)
+	if err := s.Listen(addr); err != nil {
+		t.Fatal(err)
+	}
+	run := make(chan error, 1)
+	go func() {
+		run <- s.Run()
+	}()
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s, addr, run
+}
+
+// 发起Block.Wait请求并等待方法开始执行
+func callBlock(t *testing.T, addr string, b *Block) chan error {
+	c, err := client.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+	})
+	done := make(chan error, 1)
+	go func() {
+		var reply int
+		err := c.Call("Block.Wait", 7, &reply)
+		if err == nil && reply != 7 {
+			t.Errorf("reply = %d, want 7", reply)
+		}
+		done <- err
+	}()
+	select {
+	case <-b.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("method not called")
+	}
+	return done
+}
+
+// Shutdown等待正在处理的请求发送响应后返回，期间不再接受新连接
+func TestShutdownDrainsInflight(t *testing.T) {
+	b := &Block{started: make(chan struct{}, 1), release: make(chan struct{})}
+	s, addr, run := startBlockServer(t, b)
+	call := callBlock(t, addr, b)
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- s.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the in-flight call finished", err)
+	case err := <-call:
+		t.Fatalf("call returned %v before the method finished", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if conn, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		_ = conn.Close()
+		t.Fatal("new connection accepted during shutdown")
+	}
+
+	close(b.release)
+	if err := <-call; err != nil {
+		t.Fatalf("in-flight call: %v", err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-run; err != server.ErrServerClosed {
+		t.Fatalf("Run returned %v, want ErrServerClosed", err)
+	}
+}
+
+// ctx结束时Shutdown不再等待，强制关闭连接并返回ctx.Err()
+func TestShutdownTimeout(t *testing.T) {
+	b := &Block{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(b.release)
+	s, addr, run := startBlockServer(t, b)
+	call := callBlock(t, addr, b)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown returned %v, want DeadlineExceeded", err)
+	}
+	select {
+	case err := <-call:
+		if err == nil {
+			t.Fatal("call succeeded after the connection was closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call not failed after forced close")
+	}
+	if err := <-run; err != server.ErrServerClosed {
+		t.Fatalf("Run returned %v, want ErrServerClosed", err)
+	}
+}
@@ -3,10 +3,12 @@ package reactor
 import (
 	"TinyRPC/iomux"
 	"TinyRPC/network"
+	"context"
 	"fmt"
 	"golang.org/x/sys/unix"
 	"log"
 	"sync"
+	"time"
 )
 
 // SubReactor 记录当前reactor监听的文件描述符的相关信息
@@ -14,6 +16,8 @@ type SubReactor struct {
 	handler *map[int]*connInfo
 	mu      sync.RWMutex // 保护handler的修改
 	ioMux   iomux.IoMuX  // 操作当前监听文件描述符的实例
+	waker   *iomux.Waker // 关闭时唤醒事件循环
+	wheel   *timingWheel // 连接超时的时间轮，未设置IdleTimeout、ReadTimeout且未使用TLS时为nil
 }
 
 // 存储每个连接相关的信息
@@ -21,35 +25,64 @@ type connInfo struct {
 	handlerReadTask *HandlerReadTask // read操作需要的信息
 	event           unix.EpollEvent  // 当前监听的事件
 	writeWait       chan struct{}    // 通知network层可以write
+	onClose         func()           // 连接关闭后释放连接计数
+}
+
+// 创建SubReactor实例，backend为ioMux的实现，size为每次Wait最多返回的事件数
+func newSubReactor(backend iomux.Backend, size int) (*SubReactor, iomux.IoMuX, error) {
+	handler := make(map[int]*connInfo)
+	ioMux, err := iomux.New(backend, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	waker, err := iomux.NewWaker()
+	if err != nil {
+		_ = ioMux.Close()
+		return nil, nil, err
+	}
+	if err = ioMux.Add(waker.Fd, unix.EpollEvent{Fd: int32(waker.Fd), Events: unix.EPOLLIN}); err != nil {
+		_ = ioMux.Close()
+		_ = waker.Close()
+		return nil, nil, err
+	}
+	return &SubReactor{
+		handler: &handler,
+		ioMux:   ioMux,
+		waker:   waker,
+	}, ioMux, nil
 }
 
 // 子Reactor，监听读事件
-func createSubReactor(fdCh chan int, handlerReadTask chan []*HandlerReadTask) {
+func (e *Engine) createSubReactor(sr *subReactor) {
+	defer e.loops.Done()
+
 	var (
 		networkWriteWait = make(chan int) // network层的write通知subReactor监听write事件
-		handler          = make(map[int]*connInfo)
-		subReactor       = &SubReactor{
-			handler: &handler,
-		}
+		subReactor       = sr.sub
+		ioMux            = sr.ioMux
 	)
 
-	ioMux, err := iomux.NewEpoll(5120)
-	if err != nil {
-		return
-	}
-	subReactor.ioMux = ioMux
-
 	// 接收mainReactor发送过来的需要处理的文件描述符，以及network层发过来的需要监听write事件的文件描述符
 	go func(subReactor *SubReactor) {
 		for {
 			select {
-			case fd := <-fdCh:
+			case accepted := <-sr.fd:
+				fd := accepted.fd
 				subReactor.mu.Lock()
-				wait := make(chan struct{})
+				wait := make(chan struct{}, 1)
+				ctx, cancel := context.WithCancel(context.Background())
+				conn := network.NewConnByFd(fd, wait, networkWriteWait)
+				conn.SetRemoteAddr(accepted.addr)
+				conn.SetLimits(e.opts.MaxHeaderSize, e.opts.MaxBodySize)
+				if e.opts.TLSConfig != nil {
+					conn.UseTLS(e.opts.TLSConfig, func() error { return subReactor.AddRead(fd) })
+				}
 				conninfo := &connInfo{
 					handlerReadTask: &HandlerReadTask{
 						Fd:           fd,
-						Conn:         network.NewConnByFd(fd, wait, networkWriteWait),
+						Ctx:          ctx,
+						Cancel:       cancel,
+						Conn:         conn,
 						SubReactorer: subReactor,
 					},
 					event: unix.EpollEvent{
@@ -57,53 +90,101 @@ func createSubReactor(fdCh chan int, handlerReadTask chan []*HandlerReadTask) {
 						Events: unix.EPOLLET | unix.EPOLLIN,
 					},
 					writeWait: wait,
+					onClose: func() {
+						e.releaseConn(accepted.ip)
+						sr.mu.Lock()
+						sr.num--
+						sr.mu.Unlock()
+					},
 				}
 				(*(subReactor.handler))[fd] = conninfo
 				subReactor.mu.Unlock()
 				if err := subReactor.add(fd); err != nil {
 					log.Printf("subReactor add fd %d err:%s\n", fd, err.Error())
 				}
+				if subReactor.wheel != nil {
+					// 时间轮为空时事件循环可能在无限期等待，唤醒以重新计算等待时间
+					if subReactor.wheel.add(fd, e.connDeadline(conn, time.Now())) {
+						subReactor.wakeup()
+					}
+				}
+				if conn.HandshakePending() {
+					if e.acquireHandshake() {
+						go e.handshake(conninfo.handlerReadTask)
+					} else {
+						_ = subReactor.Remove(fd)
+					}
+				}
 			case fd := <-networkWriteWait:
 				if err := subReactor.AddWrite(fd); err != nil {
 					log.Printf("subReactor add write fd %d err:%s\n", fd, err.Error())
 				}
+			case <-e.done:
+				return
 			}
 		}
 	}(subReactor)
 
 	for {
-		nevents, err := ioMux.Wait()
+		msec := -1
+		if subReactor.wheel != nil {
+			msec = subReactor.wheel.timeout(time.Now())
+		}
+		nevents, err := ioMux.Wait(msec)
 		if err != nil && err != unix.EINTR {
 			fmt.Println("subreactor err:", err.Error())
 			return
 		}
+		if subReactor.wheel != nil {
+			e.expire(subReactor)
+		}
 
 		// 每次收到事件都要创建一个新的HandlerReadTask Slice，否则后面收到的事件可能会覆盖前面的事件
 		// 导致handlerRead池处理不到前面的事件，或导致多个handlerRead处理同一Conn导致反序列化数据失败
 		var event []*HandlerReadTask
 		for ev := 0; ev < nevents; ev++ {
+			if int(ioMux.Event(ev).Fd) == subReactor.waker.Fd {
+				subReactor.waker.Reset()
+				continue
+			}
+
 			// 读取文件描述符的相关信息
 			subReactor.mu.RLock()
-			c, ok := (*(subReactor.handler))[int(ioMux.Events[ev].Fd)]
+			c, ok := (*(subReactor.handler))[int(ioMux.Event(ev).Fd)]
 			subReactor.mu.RUnlock()
 
-			if ioMux.Events[ev].Events&unix.EPOLLIN != 0 {
-				if ok {
+			if ioMux.Event(ev).Events&unix.EPOLLIN != 0 {
+				// 移除文件描述符的读监听，需要在唤醒握手之前移除，否则会覆盖握手重新添加的读监听
+				_ = subReactor.RemoveRead(int(ioMux.Event(ev).Fd))
+				if ok && !c.handlerReadTask.Conn.NotifyReadable() { // TLS握手未完成时唤醒握手，不交给handlerRead池
 					event = append(event, c.handlerReadTask)
 				}
-				// 移除文件描述符的读监听
-				_ = subReactor.RemoveRead(int(ioMux.Events[ev].Fd))
 			}
 
-			if ioMux.Events[ev].Events&unix.EPOLLOUT != 0 {
-				c.writeWait <- struct{}{}
+			if ioMux.Event(ev).Events&unix.EPOLLOUT != 0 {
+				if ok {
+					select { // writer可能已经因为连接关闭而退出，不能阻塞事件循环
+					case c.writeWait <- struct{}{}:
+					default:
+					}
+				}
 				// 移除文件描述符的写监听
-				_ = subReactor.RemoveWrite(int(ioMux.Events[ev].Fd))
+				_ = subReactor.RemoveWrite(int(ioMux.Event(ev).Fd))
 			}
 		}
 
+		select {
+		case <-e.done:
+			return
+		default:
+		}
+
 		if len(event) > 0 {
-			handlerReadTask <- event // 将文件描述符相关信息传递给handler池处理
+			select {
+			case e.handlerTask <- event: // 将文件描述符相关信息传递给handler池处理
+			case <-e.done:
+				return
+			}
 		}
 	}
 }
@@ -186,8 +267,98 @@ func (sub *SubReactor) Remove(fd int) (err error) {
 	conninfo, ok := (*(sub.handler))[fd]
 	if ok {
 		err = sub.ioMux.Remove(fd, conninfo.event)
-		_ = conninfo.handlerReadTask.C.Close()
+		conninfo.close()
 		delete(*(sub.handler), fd)
+		if sub.wheel != nil {
+			sub.wheel.remove(fd)
+		}
 	}
 	return
 }
+
+// 处理时间轮中到期的连接，真正超时的连接被关闭，其余的按最新的截止时间重新加入时间轮，不再需要超时的连接移出时间轮
+func (e *Engine) expire(sub *SubReactor) {
+	now := time.Now()
+	for _, fd := range sub.wheel.advance(now) {
+		sub.mu.RLock()
+		conninfo, ok := (*(sub.handler))[fd]
+		sub.mu.RUnlock()
+		if !ok {
+			continue
+		}
+
+		if deadline := e.connDeadline(conninfo.handlerReadTask.Conn, now); deadline.IsZero() {
+			continue
+		} else if deadline.After(now) {
+			sub.wheel.add(fd, deadline)
+		} else {
+			_ = sub.Remove(fd)
+		}
+	}
+}
+
+// 根据连接最近的活跃时间计算超时时间，有正在处理的请求时不计算空闲超时，TLS握手未完成时不超过握手超时
+func (e *Engine) connDeadline(conn *network.Conn, now time.Time) time.Time {
+	var deadline time.Time
+	if e.opts.IdleTimeout > 0 && conn.Inflight() == 0 {
+		deadline = conn.LastActive().Add(e.opts.IdleTimeout)
+	}
+	if e.opts.ReadTimeout > 0 {
+		if since, ok := conn.PartialSince(); ok {
+			if d := since.Add(e.opts.ReadTimeout); deadline.IsZero() || d.Before(deadline) {
+				deadline = d
+			}
+		}
+	}
+	if since, ok := conn.HandshakeSince(); ok {
+		if d := since.Add(e.opts.HandshakeTimeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	if deadline.IsZero() { // 暂时不会超时，之后再检查；只有握手超时时握手完成后不再检查，返回零值
+		if d := e.timeoutCheck(); d > 0 {
+			deadline = now.Add(d)
+		}
+	}
+	return deadline
+}
+
+// 没有可计算的超时时间时，下次检查的间隔
+func (e *Engine) timeoutCheck() time.Duration {
+	d := e.opts.IdleTimeout
+	if d <= 0 || (e.opts.ReadTimeout > 0 && e.opts.ReadTimeout < d) {
+		d = e.opts.ReadTimeout
+	}
+	return d
+}
+
+// 唤醒阻塞在Wait中的事件循环
+func (sub *SubReactor) wakeup() {
+	_ = sub.waker.Wake()
+}
+
+// 关闭当前subReactor监听的所有连接，以及ioMux实例，事件循环退出后调用
+func (sub *SubReactor) closeAll() {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	for fd, conninfo := range *(sub.handler) {
+		conninfo.close()
+		delete(*(sub.handler), fd)
+	}
+	_ = sub.ioMux.Close()
+	_ = sub.waker.Close()
+}
+
+// 关闭连接并取消连接的context，协商报文还未收到时序列化器为空，直接关闭Conn
+func (c *connInfo) close() {
+	c.handlerReadTask.Cancel()
+	if c.handlerReadTask.C != nil {
+		_ = c.handlerReadTask.C.Close()
+	} else {
+		_ = c.handlerReadTask.Conn.Close()
+	}
+	if c.onClose != nil {
+		c.onClose()
+	}
+}
@@ -0,0 +1,79 @@
+package reactor_test
+
+import (
+	"TinyRPC/client"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Remaining 返回请求context剩余的时间，没有截止时间时返回-1
+func (e Echo) Remaining(ctx context.Context, args int, reply *time.Duration) error {
+	*reply = -1
+	if deadline, ok := ctx.Deadline(); ok {
+		*reply = time.Until(deadline)
+	}
+	return nil
+}
+
+// Echo.Sleep结束时写入等待的时间
+var slept = make(chan time.Duration, 1)
+
+// Sleep 等待请求context取消
+func (e Echo) Sleep(ctx context.Context, args int, reply *int) error {
+	start := time.Now()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+	}
+	slept <- time.Since(start)
+	return nil
+}
+
+// 服务端按收到请求时的本地时钟和客户端发送的剩余时间计算截止时间
+func TestRequestTimeout(t *testing.T) {
+	addr := startServer(t, nil)
+	c, err := client.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var remaining time.Duration
+	if err = c.Call("Echo.Remaining", 0, &remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != -1 {
+		t.Fatalf("remaining = %v without timeout, want no deadline", remaining)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err = c.CallContext(ctx, "Echo.Remaining", 0, &remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining <= time.Second || remaining > 2*time.Second {
+		t.Fatalf("remaining = %v, want within (1s, 2s]", remaining)
+	}
+}
+
+// 超时后服务端取消请求的context
+func TestRequestTimeoutCancel(t *testing.T) {
+	addr := startServer(t, nil)
+	c, err := client.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	var reply int
+	if err = c.CallContext(ctx, "Echo.Sleep", 0, &reply); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CallContext = %v, want DeadlineExceeded", err)
+	}
+	if d := <-slept; d > time.Second {
+		t.Fatalf("server context canceled after %v, want about 100ms", d)
+	}
+}
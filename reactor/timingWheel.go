@@ -0,0 +1,176 @@
+package reactor
+
+import (
+	"sync"
+	"time"
+)
+
+// 分层时间轮，每个subReactor一个，用于关闭空闲连接和读取超时的连接
+// 每层64个槽，第0层每个槽为一个tick，第i层每个槽为64^i个tick，高层的定时器在低层转完一圈时重新分配到低层
+// 每个连接只有一个定时器，连接的读写不修改定时器，定时器到期时再根据连接最近的活跃时间判断是否真正超时（延迟重新调度）
+
+const (
+	wheelTick   = 100 * time.Millisecond // 时间轮精度
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits // 每层槽数
+	wheelMask   = wheelSlots - 1
+	wheelLevels = 4 // 层数，最长定时为64^4个tick（约19天）
+	wheelMax    = 1<<(wheelBits*wheelLevels) - 1
+)
+
+type wheelTimer struct {
+	fd     int
+	expire uint64 // 到期的tick
+	level  int
+	slot   int
+	prev   *wheelTimer
+	next   *wheelTimer
+}
+
+type timingWheel struct {
+	mu     sync.Mutex
+	start  time.Time                            // 时间轮创建时间，tick从此开始计算
+	cur    uint64                               // 已处理到的tick
+	slots  [wheelLevels][wheelSlots]*wheelTimer // 每个槽为定时器的双向链表
+	timers map[int]*wheelTimer                  // fd -> 定时器
+}
+
+func newTimingWheel() *timingWheel {
+	return &timingWheel{
+		start:  time.Now(),
+		timers: make(map[int]*wheelTimer),
+	}
+}
+
+// add 设置fd的定时器在at时到期，已有定时器时替换，返回时间轮添加前是否为空
+func (w *timingWheel) add(fd int, at time.Time) (wasEmpty bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t, ok := w.timers[fd]; ok {
+		w.unlink(t)
+	}
+	wasEmpty = len(w.timers) == 0
+
+	expire := w.tickOf(at)
+	if expire <= w.cur { // 当前tick的槽已处理
+		expire = w.cur + 1
+	}
+	t := &wheelTimer{fd: fd, expire: expire}
+	w.timers[fd] = t
+	w.place(t)
+	return
+}
+
+// remove 删除fd的定时器
+func (w *timingWheel) remove(fd int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t, ok := w.timers[fd]; ok {
+		w.unlink(t)
+		delete(w.timers, fd)
+	}
+}
+
+// advance 推进到now，返回到期的fd，到期的定时器被删除
+func (w *timingWheel) advance(now time.Time) (expired []int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	target := w.tickOf(now)
+	if len(w.timers) == 0 { // 没有定时器，直接跳到当前tick
+		if target > w.cur {
+			w.cur = target
+		}
+		return
+	}
+	for w.cur < target {
+		w.cur++
+
+		// 低层转完一圈时，从高到低将高层当前槽中的定时器重新分配
+		level := 0
+		for level+1 < wheelLevels && w.cur&(1<<(wheelBits*(level+1))-1) == 0 {
+			level++
+		}
+		for ; level > 0; level-- {
+			slot := int(w.cur>>(wheelBits*level)) & wheelMask
+			t := w.slots[level][slot]
+			w.slots[level][slot] = nil
+			for t != nil {
+				next := t.next
+				w.place(t)
+				t = next
+			}
+		}
+
+		slot := int(w.cur & wheelMask)
+		for t := w.slots[0][slot]; t != nil; t = t.next {
+			expired = append(expired, t.fd)
+			delete(w.timers, t.fd)
+		}
+		w.slots[0][slot] = nil
+	}
+	return
+}
+
+// timeout 距离下一个tick的毫秒数，用作epoll_wait的超时时间，没有定时器时返回-1
+func (w *timingWheel) timeout(now time.Time) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.timers) == 0 {
+		return -1
+	}
+	next := w.start.Add(time.Duration(w.cur+1) * wheelTick)
+	if d := next.Sub(now); d > 0 {
+		return int((d + time.Millisecond - 1) / time.Millisecond)
+	}
+	return 0
+}
+
+func (w *timingWheel) tickOf(t time.Time) uint64 {
+	d := t.Sub(w.start)
+	if d < 0 {
+		return 0
+	}
+	return uint64(d / wheelTick)
+}
+
+// 根据到期时间与当前tick的差值选择层和槽，调用方持有锁
+func (w *timingWheel) place(t *wheelTimer) {
+	if t.expire < w.cur {
+		t.expire = w.cur
+	}
+	delta := t.expire - w.cur
+	if delta > wheelMax {
+		delta = wheelMax
+		t.expire = w.cur + delta
+	}
+
+	level := 0
+	for delta >= 1<<(wheelBits*(level+1)) {
+		level++
+	}
+	t.level = level
+	t.slot = int(t.expire>>(wheelBits*level)) & wheelMask
+	t.prev = nil
+	t.next = w.slots[level][t.slot]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.slots[level][t.slot] = t
+}
+
+// 从槽的链表中移除定时器，调用方持有锁
+func (w *timingWheel) unlink(t *wheelTimer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.slots[t.level][t.slot] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next = nil, nil
+}
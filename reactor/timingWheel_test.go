@@ -0,0 +1,216 @@
+package reactor
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// 第n个tick开始的时间
+func tickAt(w *timingWheel, n uint64) time.Time {
+	return w.start.Add(time.Duration(n) * wheelTick)
+}
+
+// 逐个tick推进到n，返回每个fd到期时的tick
+func advanceTo(w *timingWheel, n uint64) map[int]uint64 {
+	expired := make(map[int]uint64)
+	for tick := w.cur + 1; tick <= n; tick++ {
+		for _, fd := range w.advance(tickAt(w, tick)) {
+			expired[fd] = tick
+		}
+	}
+	return expired
+}
+
+func TestTimingWheelEmpty(t *testing.T) {
+	w := newTimingWheel()
+	if msec := w.timeout(time.Now()); msec != -1 {
+		t.Fatalf("timeout on empty wheel = %d, want -1", msec)
+	}
+	// 没有定时器时直接跳到当前tick
+	if expired := w.advance(tickAt(w, 1000)); len(expired) != 0 {
+		t.Fatalf("expired %v on empty wheel", expired)
+	}
+	if w.cur != 1000 {
+		t.Fatalf("cur = %d, want 1000", w.cur)
+	}
+
+	if !w.add(1, tickAt(w, 1005)) {
+		t.Fatal("add on empty wheel returned wasEmpty = false")
+	}
+	if w.add(2, tickAt(w, 1005)) {
+		t.Fatal("add on non-empty wheel returned wasEmpty = true")
+	}
+	// 距离下一个tick的毫秒数，向上取整
+	now := tickAt(w, 1000).Add(30*time.Millisecond + time.Microsecond)
+	if msec, want := w.timeout(now), int(wheelTick/time.Millisecond)-30; msec != want {
+		t.Fatalf("timeout = %d, want %d", msec, want)
+	}
+	if msec := w.timeout(tickAt(w, 1002)); msec != 0 {
+		t.Fatalf("timeout after missed tick = %d, want 0", msec)
+	}
+
+	w.remove(1)
+	w.remove(2)
+	if msec := w.timeout(time.Now()); msec != -1 {
+		t.Fatalf("timeout after remove = %d, want -1", msec)
+	}
+}
+
+func TestTimingWheelTickBoundary(t *testing.T) {
+	w := newTimingWheel()
+	w.add(1, tickAt(w, 5))
+	w.add(2, tickAt(w, 5).Add(wheelTick/2)) // 在tick内的到期时间归入该tick
+	w.add(3, tickAt(w, 6).Add(-time.Nanosecond))
+	w.add(4, tickAt(w, 6))
+
+	if expired := w.advance(tickAt(w, 5).Add(-time.Nanosecond)); len(expired) != 0 {
+		t.Fatalf("expired %v before tick 5", expired)
+	}
+	expired := w.advance(tickAt(w, 5))
+	sort.Ints(expired)
+	if !reflect.DeepEqual(expired, []int{1, 2, 3}) {
+		t.Fatalf("expired at tick 5 = %v, want [1 2 3]", expired)
+	}
+	if expired = w.advance(tickAt(w, 6).Add(-time.Nanosecond)); len(expired) != 0 {
+		t.Fatalf("expired %v before tick 6", expired)
+	}
+	if expired = w.advance(tickAt(w, 6)); !reflect.DeepEqual(expired, []int{4}) {
+		t.Fatalf("expired at tick 6 = %v, want [4]", expired)
+	}
+}
+
+// 已过期的到期时间在下一个tick到期
+func TestTimingWheelPast(t *testing.T) {
+	w := newTimingWheel()
+	w.advance(tickAt(w, 10))
+	w.add(1, tickAt(w, 3))
+	w.add(2, tickAt(w, 10))
+	if got := advanceTo(w, 11); !reflect.DeepEqual(got, map[int]uint64{1: 11, 2: 11}) {
+		t.Fatalf("expired = %v, want both at tick 11", got)
+	}
+}
+
+func TestTimingWheelCascade(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		start uint64 // 添加定时器时的tick
+		ticks []uint64
+	}{
+		{"level 0", 0, []uint64{1, 63}},
+		{"64 ticks", 0, []uint64{64, 65, 127, 128, 200}},
+		{"64 ticks unaligned", 37, []uint64{100, 101, 127, 128, 164}},
+		{"4096 ticks", 0, []uint64{4095, 4096, 4097, 4160, 8191, 8192}},
+		{"4096 ticks unaligned", 4000, []uint64{4095, 4096, 4159, 8095, 8096, 12000}},
+		{"262144 ticks", 100, []uint64{262143, 262144, 262145, 300000}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTimingWheel()
+			w.advance(tickAt(w, tt.start))
+			want := make(map[int]uint64)
+			for i, tick := range tt.ticks {
+				w.add(i, tickAt(w, tick))
+				want[i] = tick
+			}
+			if got := advanceTo(w, tt.ticks[len(tt.ticks)-1]); !reflect.DeepEqual(got, want) {
+				t.Fatalf("expired = %v, want %v", got, want)
+			}
+			if len(w.timers) != 0 {
+				t.Fatalf("%d timers left", len(w.timers))
+			}
+		})
+	}
+}
+
+// 一次推进多个tick时到期的定时器与逐个tick推进相同
+func TestTimingWheelJump(t *testing.T) {
+	w := newTimingWheel()
+	for i, tick := range []uint64{3, 64, 4096, 5000} {
+		w.add(i, tickAt(w, tick))
+	}
+	expired := w.advance(tickAt(w, 4500))
+	sort.Ints(expired)
+	if !reflect.DeepEqual(expired, []int{0, 1, 2}) {
+		t.Fatalf("expired = %v, want [0 1 2]", expired)
+	}
+	if got := advanceTo(w, 5000); !reflect.DeepEqual(got, map[int]uint64{3: 5000}) {
+		t.Fatalf("expired = %v, want fd 3 at tick 5000", got)
+	}
+}
+
+func TestTimingWheelReAdd(t *testing.T) {
+	w := newTimingWheel()
+	w.add(1, tickAt(w, 10))
+	w.add(1, tickAt(w, 200)) // 延后，跨层
+	w.add(2, tickAt(w, 5000))
+	w.add(2, tickAt(w, 20)) // 提前，跨层
+	w.add(3, tickAt(w, 30))
+	w.add(3, tickAt(w, 30))
+	if len(w.timers) != 3 {
+		t.Fatalf("%d timers, want 3", len(w.timers))
+	}
+	want := map[int]uint64{1: 200, 2: 20, 3: 30}
+	if got := advanceTo(w, 5000); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expired = %v, want %v", got, want)
+	}
+}
+
+func TestTimingWheelRemove(t *testing.T) {
+	w := newTimingWheel()
+	// 同一个槽中的链表头、中间、尾部
+	for fd := 1; fd <= 5; fd++ {
+		w.add(fd, tickAt(w, 100))
+	}
+	w.add(6, tickAt(w, 7))
+	w.remove(5)
+	w.remove(3)
+	w.remove(1)
+	w.remove(6)
+	w.remove(42) // 不存在的fd
+	want := map[int]uint64{2: 100, 4: 100}
+	if got := advanceTo(w, 200); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expired = %v, want %v", got, want)
+	}
+
+	// 删除后可以重新添加
+	w.add(1, tickAt(w, 210))
+	w.remove(1)
+	w.add(1, tickAt(w, 220))
+	if got := advanceTo(w, 300); !reflect.DeepEqual(got, map[int]uint64{1: 220}) {
+		t.Fatalf("expired = %v, want fd 1 at tick 220", got)
+	}
+}
+
+// 随机添加、删除和推进，每个定时器都在到期的tick到期
+func TestTimingWheelRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	w := newTimingWheel()
+	want := make(map[int]uint64)
+	for step := 0; step < 2000; step++ {
+		fd := r.Intn(200)
+		switch r.Intn(4) {
+		case 0:
+			w.remove(fd)
+			delete(want, fd)
+		default:
+			tick := w.cur + 1 + uint64(r.Intn(10000))
+			w.add(fd, tickAt(w, tick))
+			want[fd] = tick
+		}
+
+		target := w.cur + uint64(r.Intn(500))
+		for fd, tick := range advanceTo(w, target) {
+			if want[fd] != tick {
+				t.Fatalf("fd %d expired at tick %d, want %d", fd, tick, want[fd])
+			}
+			delete(want, fd)
+		}
+		for fd, tick := range want {
+			if tick <= w.cur {
+				t.Fatalf("fd %d not expired at tick %d, cur %d", fd, tick, w.cur)
+			}
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package reactor_test
+
+import (
+	"TinyRPC/client"
+	"TinyRPC/peer"
+	"TinyRPC/reactor"
+	"TinyRPC/server"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+type Echo int
+
+func (e Echo) Echo(args string, reply *string) error {
+	*reply = args
+	return nil
+}
+
+// Who 返回客户端证书的CommonName
+func (e Echo) Who(ctx context.Context, args string, reply *string) error {
+	if p, ok := peer.FromContext(ctx); ok && p.TLS != nil && len(p.TLS.PeerCertificates) > 0 {
+		*reply = p.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	return nil
+}
+
+// 测试用的证书，parent为nil时生成自签名证书
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		parent, parentKey = tpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, c, key
+}
+
+type testPKI struct {
+	pool   *x509.CertPool
+	server tls.Certificate
+	client tls.Certificate
+}
+
+func newPKI(t *testing.T) *testPKI {
+	_, ca, caKey := newCert(t, "ca", nil, nil)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv, _, _ := newCert(t, "server", ca, caKey)
+	cli, _, _ := newCert(t, "alice", ca, caKey)
+	return &testPKI{pool: pool, server: srv, client: cli}
+}
+
+// 获取一个空闲端口
+func freeAddr(t testing.TB) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+// 启动服务端，测试结束时关闭
+func startServer(t testing.TB, opts *reactor.ReactorOptions) string {
+	addr := freeAddr(t)
+	s := server.New()
+	s.Register(new(Echo))
+	if err := s.Listen(addr, opts); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_ = s.Run()
+	}()
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return addr
+}
+
+func dialTLS(addr string, config *tls.Config) (*client.Client, error) {
+	return client.DialWithOptions("tcp", addr, &client.DialOptions{TLSConfig: config, HandshakeTimeout: time.Second})
+}
+
+func TestTLS(t *testing.T) {
+	pki := newPKI(t)
+	addr := startServer(t, &reactor.ReactorOptions{
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{pki.server}},
+	})
+
+	for _, opt := range []*server.Option{{CodecType: "gob"}, {CodecType: "json", Compression: "gzip"}} {
+		c, err := client.DialWithOptions("tcp", addr, &client.DialOptions{
+			Option:    opt,
+			TLSConfig: &tls.Config{RootCAs: pki.pool},
+		})
+		if err != nil {
+			t.Fatalf("%s: dial: %v", opt.CodecType, err)
+		}
+		// 超过一个TLS record的报文
+		big := string(make([]byte, 1<<20))
+		for _, args := range []string{"hello", big} {
+			var reply string
+			if err = c.Call("Echo.Echo", args, &reply); err != nil {
+				t.Fatalf("%s: call: %v", opt.CodecType, err)
+			}
+			if reply != args {
+				t.Fatalf("%s: reply mismatch, got %d bytes, want %d", opt.CodecType, len(reply), len(args))
+			}
+		}
+		c.Close()
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	pki := newPKI(t)
+	addr := startServer(t, &reactor.ReactorOptions{
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{pki.server},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pki.pool,
+		},
+	})
+
+	t.Run("client cert", func(t *testing.T) {
+		c, err := dialTLS(addr, &tls.Config{RootCAs: pki.pool, Certificates: []tls.Certificate{pki.client}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		var reply string
+		if err = c.Call("Echo.Who", "", &reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply != "alice" {
+			t.Fatalf("peer common name = %q, want %q", reply, "alice")
+		}
+	})
+
+	t.Run("no client cert", func(t *testing.T) {
+		// TLS 1.3的客户端在服务端验证证书之前就完成握手，错误在第一次调用时返回
+		c, err := dialTLS(addr, &tls.Config{RootCAs: pki.pool})
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var reply string
+		if err = c.Call("Echo.Who", "", &reply); err == nil {
+			t.Fatal("call without client certificate succeeded")
+		}
+	})
+}
+
+func TestTLSPlaintextClient(t *testing.T) {
+	pki := newPKI(t)
+	addr := startServer(t, &reactor.ReactorOptions{
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{pki.server}},
+	})
+
+	c, err := client.Dial("tcp", addr)
+	if err != nil {
+		return // 协商报文被拒绝
+	}
+	defer c.Close()
+	var reply string
+	if err = c.Call("Echo.Echo", "hello", &reply); err == nil {
+		t.Fatal("plaintext call succeeded")
+	}
+}
+
+// 等待服务端关闭连接，返回等待的时间
+func waitClosed(t *testing.T, conn net.Conn, timeout time.Duration) time.Duration {
+	start := time.Now()
+	_ = conn.SetReadDeadline(start.Add(timeout))
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("server sent data before handshake")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatalf("connection not closed within %v", timeout)
+	}
+	return time.Since(start)
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	pki := newPKI(t)
+	addr := startServer(t, &reactor.ReactorOptions{
+		TLSConfig:        &tls.Config{Certificates: []tls.Certificate{pki.server}},
+		HandshakeTimeout: 300 * time.Millisecond,
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if d := waitClosed(t, conn, 3*time.Second); d < 200*time.Millisecond {
+		t.Fatalf("connection closed after %v, before handshake timeout", d)
+	}
+}
+
+func TestMaxHandshakes(t *testing.T) {
+	pki := newPKI(t)
+	addr := startServer(t, &reactor.ReactorOptions{
+		TLSConfig:     &tls.Config{Certificates: []tls.Certificate{pki.server}},
+		MaxHandshakes: 1,
+	})
+
+	// 不发送ClientHello，一直占用握手
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	waitClosed(t, conn, time.Second)
+
+	// 占用握手的连接关闭后可以正常握手
+	_ = idle.Close()
+	time.Sleep(100 * time.Millisecond)
+	c, err := dialTLS(addr, &tls.Config{RootCAs: pki.pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var reply string
+	if err = c.Call("Echo.Echo", "hello", &reply); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,113 @@
+package reactor_test
+
+import (
+	"TinyRPC/client"
+	"TinyRPC/reactor"
+	"TinyRPC/server"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// 在path上启动Engine，返回Engine及Run的返回值
+func startUnixEngine(t *testing.T, path string, opts *reactor.ReactorOptions) (*reactor.Engine, chan error) {
+	t.Helper()
+	s := server.New()
+	s.Register(new(Echo))
+	e, err := reactor.NewEngine(reactor.UnixScheme+path, s, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := make(chan error, 1)
+	go func() {
+		run <- e.Run()
+	}()
+	t.Cleanup(func() {
+		_ = e.Close()
+	})
+	return e, run
+}
+
+func callUnix(t *testing.T, path string) {
+	t.Helper()
+	c, err := client.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var reply string
+	if err = c.Call("Echo.Echo", "ping", &reply); err != nil || reply != "ping" {
+		t.Fatalf("Echo.Echo = %q, %v", reply, err)
+	}
+}
+
+// 设置套接字文件权限，Close后删除套接字文件
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+	e, run := startUnixEngine(t, path, &reactor.ReactorOptions{UnixSocketMode: 0600})
+
+	fi, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Fatalf("mode = %v, want socket with 0600", fi.Mode())
+	}
+	callUnix(t, path)
+
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-run; err != reactor.ErrEngineClosed {
+		t.Fatalf("Run returned %v, want ErrEngineClosed", err)
+	}
+	if _, err = os.Lstat(path); !os.IsNotExist(err) {
+		t.Fatalf("socket file not removed after Close: %v", err)
+	}
+}
+
+// 之前的进程异常退出时留下的套接字文件被删除后重新监听
+func TestUnixSocketStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = l.Close()
+	if _, err = os.Lstat(path); err != nil {
+		t.Fatalf("stale socket file: %v", err)
+	}
+
+	startUnixEngine(t, path, nil)
+	callUnix(t, path)
+}
+
+// 套接字文件仍有进程监听时不接管，原来的服务端不受影响
+func TestUnixSocketInUse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+	startUnixEngine(t, path, nil)
+
+	_, err := reactor.NewEngine(reactor.UnixScheme+path, server.New(), nil)
+	if !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("NewEngine on a live socket = %v, want EADDRINUSE", err)
+	}
+	callUnix(t, path)
+}
+
+// 路径上已有的普通文件不会被删除
+func TestUnixSocketNotSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpc.sock")
+	if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reactor.NewEngine(reactor.UnixScheme+path, server.New(), nil); err == nil {
+		t.Fatal("NewEngine replaced a regular file")
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "data" {
+		t.Fatalf("file changed: %q, %v", b, err)
+	}
+}
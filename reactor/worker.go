@@ -1,8 +1,36 @@
 package reactor
 
+import (
+	"TinyRPC/status"
+	"log"
+	"time"
+)
+
 // worker池，处理业务逻辑
-func createWorker(workTask chan *WorkerTask, server Server, handlerWriteTask chan *WorkerTask) {
-	for work := range workTask {
-		server.HandleRequest(work, handlerWriteTask)
+func (e *Engine) createWorker() {
+	for {
+		select {
+		case work := <-e.workerTask:
+			if e.shedder != nil {
+				e.shedder.observe(time.Since(work.Enqueued))
+			}
+			e.handleRequest(work)
+		case <-e.done:
+			return
+		}
 	}
 }
+
+// 业务方法的panic由Server.HandleRequest处理，此处兜底，保证worker goroutine不会退出且请求一定发送响应或被释放
+func (e *Engine) handleRequest(work *WorkerTask) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("reactor: worker recover from panic: %v\n", r)
+			if work.Req.H.Error == "" {
+				e.s.RejectRequest(work.Req, status.New(status.Internal, "rpc server: internal error"))
+			}
+		}
+		e.sendWrite(work)
+	}()
+	e.s.HandleRequest(work)
+}
@@ -29,14 +29,19 @@ const (
 	RoundRobinSelect
 )
 
-// NewBalance 返回负载均衡实例
-func NewBalance() (*Balance, error) {
+// NewBalance 返回负载均衡实例，dopts用于连接注册中心，未传入时使用config.RegisterDial作为连接超时时间
+func NewBalance(dopts ...*client.DialOptions) (*Balance, error) {
 	balance := &Balance{
 		services: make(GetInfo),
 		r:        rand.New(rand.NewSource(time.Now().UnixNano())),
 		index:    make(map[ServiceName]int),
 	}
-	c, err := client.Dial("tcp", config.RegisterAddr)
+	dopt := &client.DialOptions{ConnectTimeout: config.RegisterDial, HandshakeTimeout: config.RegisterDial}
+	if len(dopts) > 0 && dopts[0] != nil {
+		dopt = dopts[0]
+	}
+	protocol, address := client.ParseAddr(config.RegisterAddr)
+	c, err := client.DialWithOptions(protocol, address, dopt)
 	if err != nil {
 		return nil, errors.New("refresh services from register error:" + err.Error())
 	}
@@ -5,37 +5,54 @@ package register
 
 import (
 	"TinyRPC/client"
+	"TinyRPC/config"
 	"TinyRPC/server"
+	"context"
 	"sync"
 )
 
 type BalanceClient struct {
-	balance *Balance       // 负载均衡实例
-	mode    SelectMode     // 负载均衡方式
-	opt     *server.Option // 连接客户端的协商报文
-	clients sync.Map       // map[服务器地址]*client.Client客户端实例
+	balance *Balance            // 负载均衡实例
+	mode    SelectMode          // 负载均衡方式
+	dopts   *client.DialOptions // 连接服务器的配置
+	clients sync.Map            // map[服务器地址]*client.Client客户端实例
 	mu      sync.Mutex
+
+	interceptors client.Interceptors // 客户端拦截器，invoker返回后CallInfo.Addr为本次调用选择的服务器地址
 }
 
 // Dial 创建包含负载均衡的客户端
 func Dial(mode SelectMode, opts ...*server.Option) (*BalanceClient, error) {
-	balance, err := NewBalance()
+	return DialWithOptions(mode, &client.DialOptions{Option: client.ParseOption(opts...)})
+}
+
+// DialWithOptions 创建包含负载均衡的客户端，dopts用于连接每一个服务器
+func DialWithOptions(mode SelectMode, dopts *client.DialOptions) (*BalanceClient, error) {
+	if dopts == nil {
+		dopts = &client.DialOptions{}
+	}
+	balance, err := NewBalance(&client.DialOptions{
+		ConnectTimeout:   config.RegisterDial,
+		HandshakeTimeout: config.RegisterDial,
+		KeepAlive:        dopts.KeepAlive,
+		DisableNoDelay:   dopts.DisableNoDelay,
+	})
 	if err != nil {
 		return nil, err
 	}
 	c := &BalanceClient{
 		balance: balance,
 		mode:    mode,
-		opt:     client.ParseOption(opts...),
+		dopts:   dopts,
 	}
 	return c, nil
 }
 
 // 通过负载均衡获取服务端地址，并创建连接
-func (balanceC *BalanceClient) getClient(serviceName ServiceName) (*client.Client, error) {
+func (balanceC *BalanceClient) getClient(serviceName ServiceName) (*client.Client, Addr, error) {
 	addr, err := balanceC.balance.Get(balanceC.mode, serviceName)
 	if err != nil {
-		return nil, err
+		return nil, addr, err
 	}
 
 	cI, ok := balanceC.clients.Load(addr)
@@ -46,29 +63,53 @@ func (balanceC *BalanceClient) getClient(serviceName ServiceName) (*client.Clien
 
 		cI, ok = balanceC.clients.Load(addr)
 		if !ok || cI.(*client.Client).IsClose() {
-			c, err := client.Dial("tcp", string(addr), balanceC.opt)
+			protocol, address := client.ParseAddr(string(addr)) // 服务器可以注册"unix://"地址
+			c, err := client.DialWithOptions(protocol, address, balanceC.dopts)
 			if err != nil {
-				return nil, err
+				return nil, addr, err
 			}
-			cI, ok = balanceC.clients.LoadOrStore(addr, c)
+			balanceC.clients.Store(addr, c) // 替换已关闭的客户端
+			cI = c
 		}
 	}
 
-	return cI.(*client.Client), nil
+	return cI.(*client.Client), addr, nil
+}
+
+// Use 添加拦截器，拦截Call、CallContext、Go发起的请求，先添加的拦截器先执行
+func (balanceC *BalanceClient) Use(interceptors ...client.UnaryClientInterceptor) {
+	balanceC.interceptors.Use(interceptors...)
 }
 
 // Call 同步请求
-func (balanceC *BalanceClient) Call(serviceMethod string, argv, reply interface{}) error {
-	c, err := balanceC.getClient(ServiceName(serviceMethod))
-	if err != nil {
-		return err
-	}
-	return c.Call(serviceMethod, argv, reply)
+func (balanceC *BalanceClient) Call(serviceMethod string, argv, reply interface{}, opts ...client.CallOption) error {
+	return balanceC.CallContext(context.Background(), serviceMethod, argv, reply, opts...)
 }
 
-// Go 异步请求
+// CallContext 同步请求，超时及元数据规则与client.CallContext相同
+// 每次调用invoker（如重试拦截器）都重新选择服务器并获取连接，选择或连接失败的错误同样经过拦截器
+func (balanceC *BalanceClient) CallContext(ctx context.Context, serviceMethod string, argv, reply interface{}, opts ...client.CallOption) error {
+	ctx = client.ApplyCallOptions(ctx, opts...)
+	info := &client.CallInfo{ServiceMethod: serviceMethod}
+	return balanceC.interceptors.Invoker(info, func(ctx context.Context, info *client.CallInfo, argv, reply interface{}) error {
+		c, addr, err := balanceC.getClient(ServiceName(info.ServiceMethod))
+		info.Addr = string(addr)
+		if err != nil {
+			return err
+		}
+		return c.CallContext(ctx, info.ServiceMethod, argv, reply)
+	})(ctx, serviceMethod, argv, reply)
+}
+
+// Go 异步请求，设置了拦截器时，请求在新的goroutine中经过拦截器发送
 func (balanceC *BalanceClient) Go(serviceMethod string, argv, reply interface{}) (*client.Call, error) {
-	c, err := balanceC.getClient(ServiceName(serviceMethod))
+	if len(balanceC.interceptors.Load()) > 0 {
+		return client.Async(serviceMethod, argv, reply, func() error {
+			return balanceC.CallContext(context.Background(), serviceMethod, argv, reply)
+		}), nil
+	}
+
+	c, _, err := balanceC.getClient(ServiceName(serviceMethod))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"TinyRPC/peer"
+	"TinyRPC/status"
+	"context"
+	"fmt"
+	"net"
+	"path"
+)
+
+// 访问控制，ServerCodec找到服务后按顺序匹配规则，第一条匹配的规则决定是否允许调用，都不匹配时使用默认策略
+// 条件中的字符串支持path.Match的通配符，如"Arith.*"、"admin-*"
+
+// ACLRule 访问控制规则，条件为空时匹配任意值，多个条件同时满足时规则匹配
+type ACLRule struct {
+	Allow       bool     // true允许调用，false拒绝调用
+	Methods     []string // "Service.Method"，如"Arith.*"
+	Principals  []string // 鉴权得到的身份，见Authenticator
+	Identities  []string // 客户端在协商报文中声明的身份，见Option.Identity
+	CommonNames []string // TLS客户端证书的CommonName
+	CIDRs       []string // 对端地址所在网段，如"10.0.0.0/8"
+	nets        []*net.IPNet
+}
+
+// ACL 访问控制策略，创建后不可修改，重新加载时创建新的ACL并调用SetACL
+type ACL struct {
+	rules        []ACLRule
+	defaultAllow bool
+}
+
+// NewACL 创建访问控制策略，defaultAllow为规则都不匹配时是否允许调用
+func NewACL(defaultAllow bool, rules ...ACLRule) (*ACL, error) {
+	acl := &ACL{defaultAllow: defaultAllow}
+	for i, rule := range rules {
+		for _, patterns := range [][]string{rule.Methods, rule.Principals, rule.Identities, rule.CommonNames} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("rpc server: acl rule %d: invalid pattern %q", i, pattern)
+				}
+			}
+		}
+		rule.nets = nil
+		for _, cidr := range rule.CIDRs {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("rpc server: acl rule %d: %v", i, err)
+			}
+			rule.nets = append(rule.nets, ipNet)
+		}
+		acl.rules = append(acl.rules, rule)
+	}
+	return acl, nil
+}
+
+// SetACL 设置访问控制策略，运行中调用立即对之后的请求生效，为nil时不做访问控制
+func (server *Server) SetACL(acl *ACL) {
+	server.acl.Store(acl)
+}
+
+// 检查ctx对应的调用方能否调用serviceMethod，拒绝时返回PermissionDenied
+func (server *Server) checkACL(ctx context.Context, serviceMethod string) error {
+	acl, _ := server.acl.Load().(*ACL)
+	if acl == nil || acl.Allow(ctx, serviceMethod) {
+		return nil
+	}
+	return status.Newf(status.PermissionDenied, "rpc server: permission denied for %s", serviceMethod)
+}
+
+// Allow 判断ctx对应的调用方能否调用serviceMethod
+func (acl *ACL) Allow(ctx context.Context, serviceMethod string) bool {
+	for i := range acl.rules {
+		if acl.rules[i].match(ctx, serviceMethod) {
+			return acl.rules[i].Allow
+		}
+	}
+	return acl.defaultAllow
+}
+
+func (rule *ACLRule) match(ctx context.Context, serviceMethod string) bool {
+	if !matchAny(rule.Methods, serviceMethod) {
+		return false
+	}
+	if len(rule.Principals) > 0 {
+		principal, ok := PrincipalFromContext(ctx)
+		if !ok || !matchAny(rule.Principals, principal) {
+			return false
+		}
+	}
+	if len(rule.Identities) > 0 {
+		identity, _ := IdentityFromContext(ctx)
+		if identity == "" || !matchAny(rule.Identities, identity) {
+			return false
+		}
+	}
+
+	p, _ := peer.FromContext(ctx)
+	if len(rule.CommonNames) > 0 {
+		if p == nil || p.TLS == nil || len(p.TLS.PeerCertificates) == 0 ||
+			!matchAny(rule.CommonNames, p.TLS.PeerCertificates[0].Subject.CommonName) {
+			return false
+		}
+	}
+	if len(rule.nets) > 0 {
+		if p == nil || !containsIP(rule.nets, p.Addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// patterns为空时匹配任意值
+func matchAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(nets []*net.IPNet, addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range nets {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
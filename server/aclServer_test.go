@@ -0,0 +1,152 @@
+package server
+
+import (
+	"TinyRPC/peer"
+	"TinyRPC/status"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"testing"
+)
+
+// 调用方信息，字段为空时不写入context
+type caller struct {
+	principal string
+	identity  string
+	cn        string
+	ip        string
+}
+
+func (c caller) context() context.Context {
+	ctx := context.Background()
+	if c.principal != "" {
+		ctx = newPrincipalContext(ctx, c.principal)
+	}
+	if c.identity != "" {
+		ctx = newIdentityContext(ctx, c.identity)
+	}
+	p := &peer.Peer{}
+	if c.ip != "" {
+		p.Addr = &net.TCPAddr{IP: net.ParseIP(c.ip), Port: 40000}
+	}
+	if c.cn != "" {
+		p.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: c.cn}}}}
+	}
+	return peer.NewContext(ctx, p)
+}
+
+func TestCheckACL(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultAllow  bool
+		rules         []ACLRule
+		caller        caller
+		serviceMethod string
+		allow         bool
+	}{
+		{"no rules default deny", false, nil, caller{}, "Arith.Add", false},
+		{"no rules default allow", true, nil, caller{}, "Arith.Add", true},
+
+		// path.Match通配符
+		{"method wildcard", false, []ACLRule{{Allow: true, Methods: []string{"Arith.*"}}}, caller{}, "Arith.Add", true},
+		{"method wildcard other service", false, []ACLRule{{Allow: true, Methods: []string{"Arith.*"}}}, caller{}, "Admin.Add", false},
+		{"star matches dotted name", false, []ACLRule{{Allow: true, Methods: []string{"*"}}}, caller{}, "Arith.Add", true},
+		{"single char wildcard", false, []ACLRule{{Allow: true, Methods: []string{"Arith.?dd"}}}, caller{}, "Arith.Add", true},
+		{"char class", false, []ACLRule{{Allow: true, Methods: []string{"Arith.[AM]*"}}}, caller{}, "Arith.Mul", true},
+		{"char class miss", false, []ACLRule{{Allow: true, Methods: []string{"Arith.[AM]*"}}}, caller{}, "Arith.Div", false},
+		{"principal wildcard", false, []ACLRule{{Allow: true, Principals: []string{"admin-*"}}}, caller{principal: "admin-7"}, "Arith.Add", true},
+		{"principal missing", false, []ACLRule{{Allow: true, Principals: []string{"*"}}}, caller{}, "Arith.Add", false},
+		{"identity", false, []ACLRule{{Allow: true, Identities: []string{"svc-?"}}}, caller{identity: "svc-a"}, "Arith.Add", true},
+		{"identity missing", false, []ACLRule{{Allow: true, Identities: []string{"*"}}}, caller{}, "Arith.Add", false},
+		{"common name", false, []ACLRule{{Allow: true, CommonNames: []string{"*.internal"}}}, caller{cn: "db.internal"}, "Arith.Add", true},
+		{"common name without tls", false, []ACLRule{{Allow: true, CommonNames: []string{"*"}}}, caller{}, "Arith.Add", false},
+
+		// CIDR，IPv4映射的IPv6地址按IPv4匹配
+		{"ipv4 cidr", false, []ACLRule{{Allow: true, CIDRs: []string{"10.0.0.0/8"}}}, caller{ip: "10.1.2.3"}, "Arith.Add", true},
+		{"ipv4 cidr miss", false, []ACLRule{{Allow: true, CIDRs: []string{"10.0.0.0/8"}}}, caller{ip: "192.168.1.1"}, "Arith.Add", false},
+		{"ipv4-mapped peer", false, []ACLRule{{Allow: true, CIDRs: []string{"10.0.0.0/8"}}}, caller{ip: "::ffff:10.1.2.3"}, "Arith.Add", true},
+		{"ipv4-mapped peer miss", false, []ACLRule{{Allow: true, CIDRs: []string{"10.0.0.0/8"}}}, caller{ip: "::ffff:192.168.1.1"}, "Arith.Add", false},
+		{"ipv6 cidr", false, []ACLRule{{Allow: true, CIDRs: []string{"fd00::/8"}}}, caller{ip: "fd12::1"}, "Arith.Add", true},
+		{"ipv6 peer ipv4 cidr", false, []ACLRule{{Allow: true, CIDRs: []string{"10.0.0.0/8"}}}, caller{ip: "fd12::1"}, "Arith.Add", false},
+		{"multiple cidrs", false, []ACLRule{{Allow: true, CIDRs: []string{"192.168.0.0/16", "127.0.0.0/8"}}}, caller{ip: "127.0.0.1"}, "Arith.Add", true},
+		{"cidr without peer addr", false, []ACLRule{{Allow: true, CIDRs: []string{"0.0.0.0/0"}}}, caller{}, "Arith.Add", false},
+
+		// 多个条件同时满足才匹配
+		{"all conditions", false, []ACLRule{{Allow: true, Methods: []string{"Arith.*"}, Principals: []string{"alice"}, CIDRs: []string{"10.0.0.0/8"}}},
+			caller{principal: "alice", ip: "10.0.0.1"}, "Arith.Add", true},
+		{"one condition fails", false, []ACLRule{{Allow: true, Methods: []string{"Arith.*"}, Principals: []string{"alice"}, CIDRs: []string{"10.0.0.0/8"}}},
+			caller{principal: "alice", ip: "11.0.0.1"}, "Arith.Add", false},
+
+		// 第一条匹配的规则决定结果
+		{"deny before allow", true, []ACLRule{
+			{Allow: false, Methods: []string{"Admin.*"}},
+			{Allow: true, Principals: []string{"root"}},
+		}, caller{principal: "root"}, "Admin.Reset", false},
+		{"allow before deny", false, []ACLRule{
+			{Allow: true, Principals: []string{"root"}},
+			{Allow: false, Methods: []string{"Admin.*"}},
+		}, caller{principal: "root"}, "Admin.Reset", true},
+		{"falls through to later rule", false, []ACLRule{
+			{Allow: false, Methods: []string{"Admin.*"}},
+			{Allow: true, CIDRs: []string{"127.0.0.0/8"}},
+		}, caller{ip: "127.0.0.1"}, "Arith.Add", true},
+		{"falls through to default", true, []ACLRule{
+			{Allow: false, Methods: []string{"Admin.*"}},
+			{Allow: true, Principals: []string{"root"}},
+		}, caller{principal: "bob"}, "Arith.Add", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := NewACL(tt.defaultAllow, tt.rules...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := New()
+			s.SetACL(acl)
+			err = s.checkACL(tt.caller.context(), tt.serviceMethod)
+			if tt.allow && err != nil {
+				t.Fatalf("denied: %v", err)
+			}
+			if !tt.allow {
+				if err == nil {
+					t.Fatal("allowed, want denied")
+				}
+				if code := status.Convert(err).Code; code != status.PermissionDenied {
+					t.Fatalf("code = %v, want PermissionDenied", code)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckACLUnset(t *testing.T) {
+	s := New()
+	if err := s.checkACL(context.Background(), "Arith.Add"); err != nil {
+		t.Fatal(err)
+	}
+	acl, _ := NewACL(false)
+	s.SetACL(acl)
+	if err := s.checkACL(context.Background(), "Arith.Add"); err == nil {
+		t.Fatal("allowed with default deny")
+	}
+	s.SetACL(nil)
+	if err := s.checkACL(context.Background(), "Arith.Add"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewACLInvalid(t *testing.T) {
+	for _, rule := range []ACLRule{
+		{Methods: []string{"Arith.["}},
+		{Principals: []string{"[a-"}},
+		{CIDRs: []string{"10.0.0.0"}},
+		{CIDRs: []string{"10.0.0.0/33"}},
+	} {
+		if _, err := NewACL(true, rule); err == nil {
+			t.Errorf("NewACL(%+v) succeeded", rule)
+		}
+	}
+}
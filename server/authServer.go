@@ -0,0 +1,181 @@
+package server
+
+import (
+	"TinyRPC/status"
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 连接鉴权，客户端在协商报文中携带凭证，SelectCodec在创建序列化器之前调用Authenticator，鉴权失败时关闭连接
+
+// Credentials 客户端凭证，随协商报文发送
+type Credentials struct {
+	Token     string // bearer token
+	KeyID     string // HMAC密钥编号
+	Nonce     string // 随机数，同一个nonce在时间窗口内只能使用一次
+	Timestamp int64  // 签名时间（Unix秒）
+	Signature string // SignHMAC的结果
+}
+
+// Authenticator 鉴权接口，返回连接的身份（principal），返回错误时关闭连接
+// ctx为连接的context，可通过peer.FromContext获取对端信息
+type Authenticator interface {
+	Authenticate(ctx context.Context, opt *Option) (principal string, err error)
+}
+
+// AuthenticatorFunc 函数形式的Authenticator
+type AuthenticatorFunc func(ctx context.Context, opt *Option) (string, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, opt *Option) (string, error) {
+	return f(ctx, opt)
+}
+
+// SetAuthenticator 设置连接鉴权，为nil时不鉴权，只影响之后建立的连接
+func (server *Server) SetAuthenticator(a Authenticator) {
+	server.authenticator.Store(&a)
+}
+
+func (server *Server) getAuthenticator() Authenticator {
+	if a, ok := server.authenticator.Load().(*Authenticator); ok {
+		return *a
+	}
+	return nil
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext 获取连接鉴权得到的身份，未设置Authenticator时返回false
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	p, ok := ctx.Value(principalKey{}).(string)
+	return p, ok
+}
+
+func newPrincipalContext(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+type identityKey struct{}
+
+// IdentityFromContext 获取客户端在协商报文中声明的身份（Option.Identity），未经校验
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(identityKey{}).(string)
+	return id, ok
+}
+
+func newIdentityContext(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+func credentialsOf(opt *Option) (*Credentials, error) {
+	if opt.Credentials == nil {
+		return nil, status.New(status.Unauthenticated, "rpc server: missing credentials")
+	}
+	return opt.Credentials, nil
+}
+
+// TokenAuthenticator 校验bearer token，key为token，value为token对应的身份
+type TokenAuthenticator map[string]string
+
+func (a TokenAuthenticator) Authenticate(ctx context.Context, opt *Option) (string, error) {
+	cred, err := credentialsOf(opt)
+	if err != nil {
+		return "", err
+	}
+	for token, principal := range a { // 逐个比较，避免通过比较耗时猜测token
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cred.Token)) == 1 {
+			return principal, nil
+		}
+	}
+	return "", status.New(status.Unauthenticated, "rpc server: invalid token")
+}
+
+// SignHMAC 计算HMAC-SHA256(key, keyID + "\n" + nonce + "\n" + timestamp)，结果为hex编码
+func SignHMAC(key []byte, keyID, nonce string, timestamp int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(keyID + "\n" + nonce + "\n" + strconv.FormatInt(timestamp, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HMACAuthenticator 校验HMAC签名的nonce，身份为KeyID
+// 签名时间与服务端时间相差超过MaxSkew的凭证无效，时间窗口内重复使用的nonce无效，防止重放
+type HMACAuthenticator struct {
+	keys    map[string][]byte   // KeyID -> 密钥
+	maxSkew time.Duration       // 允许的时间偏差
+	mu      sync.Mutex          // 保护nonces、expiry
+	nonces  map[string]struct{} // 时间窗口内已使用的nonce
+	expiry  nonceHeap           // 按过期时间排序的nonce，每次校验只清理已过期的部分
+}
+
+// 已使用的nonce及其过期时间，过期后签名时间超出窗口，nonce不会再被接受
+type nonceEntry struct {
+	id     string
+	expire time.Time
+}
+
+// nonceHeap 按过期时间排序的最小堆，实现heap.Interface
+type nonceHeap []nonceEntry
+
+func (h nonceHeap) Len() int            { return len(h) }
+func (h nonceHeap) Less(i, j int) bool  { return h[i].expire.Before(h[j].expire) }
+func (h nonceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nonceHeap) Push(x interface{}) { *h = append(*h, x.(nonceEntry)) }
+func (h *nonceHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nonceEntry{} // 释放对nonce的引用
+	*h = old[:len(old)-1]
+	return e
+}
+
+// NewHMACAuthenticator 创建HMACAuthenticator，maxSkew不大于0时使用默认值5分钟
+func NewHMACAuthenticator(keys map[string][]byte, maxSkew time.Duration) *HMACAuthenticator {
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	return &HMACAuthenticator{
+		keys:    keys,
+		maxSkew: maxSkew,
+		nonces:  make(map[string]struct{}),
+	}
+}
+
+func (a *HMACAuthenticator) Authenticate(ctx context.Context, opt *Option) (string, error) {
+	cred, err := credentialsOf(opt)
+	if err != nil {
+		return "", err
+	}
+	key, ok := a.keys[cred.KeyID]
+	if !ok || cred.Nonce == "" {
+		return "", status.New(status.Unauthenticated, "rpc server: invalid hmac credentials")
+	}
+
+	now := time.Now()
+	signed := time.Unix(cred.Timestamp, 0)
+	if signed.Before(now.Add(-a.maxSkew)) || signed.After(now.Add(a.maxSkew)) {
+		return "", status.New(status.Unauthenticated, "rpc server: hmac credentials expired")
+	}
+	expect := SignHMAC(key, cred.KeyID, cred.Nonce, cred.Timestamp)
+	if !hmac.Equal([]byte(expect), []byte(cred.Signature)) {
+		return "", status.New(status.Unauthenticated, "rpc server: invalid hmac signature")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for len(a.expiry) > 0 && now.After(a.expiry[0].expire) { // 清理已过期的nonce
+		delete(a.nonces, heap.Pop(&a.expiry).(nonceEntry).id)
+	}
+	id := cred.KeyID + "\n" + cred.Nonce
+	if _, used := a.nonces[id]; used {
+		return "", status.New(status.Unauthenticated, "rpc server: hmac nonce reused")
+	}
+	a.nonces[id] = struct{}{}
+	heap.Push(&a.expiry, nonceEntry{id: id, expire: signed.Add(a.maxSkew)})
+	return cred.KeyID, nil
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"TinyRPC/status"
+	"container/heap"
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKeys = map[string][]byte{
+	"k1": []byte("secret-1"),
+	"k2": []byte("secret-2"),
+}
+
+func hmacOption(keyID string, key []byte, nonce string, ts int64) *Option {
+	return &Option{Credentials: &Credentials{
+		KeyID:     keyID,
+		Nonce:     nonce,
+		Timestamp: ts,
+		Signature: SignHMAC(key, keyID, nonce, ts),
+	}}
+}
+
+// 鉴权失败时返回Unauthenticated，错误信息包含msg
+func wantUnauthenticated(t *testing.T, a Authenticator, opt *Option, msg string) {
+	t.Helper()
+	principal, err := a.Authenticate(context.Background(), opt)
+	if err == nil {
+		t.Fatalf("authenticated as %q, want error", principal)
+	}
+	st := status.Convert(err)
+	if st.Code != status.Unauthenticated || !strings.Contains(st.Message, msg) {
+		t.Fatalf("error = %v, want Unauthenticated containing %q", err, msg)
+	}
+}
+
+func TestHMACValid(t *testing.T) {
+	a := NewHMACAuthenticator(testKeys, time.Minute)
+	now := time.Now().Unix()
+	for _, tt := range []struct {
+		keyID string
+		ts    int64
+	}{{"k1", now}, {"k2", now}, {"k1", now - 50}, {"k1", now + 50}} {
+		opt := hmacOption(tt.keyID, testKeys[tt.keyID], "nonce-"+strconv.FormatInt(tt.ts, 10), tt.ts)
+		principal, err := a.Authenticate(context.Background(), opt)
+		if err != nil {
+			t.Fatalf("%s at %d: %v", tt.keyID, tt.ts-now, err)
+		}
+		if principal != tt.keyID {
+			t.Fatalf("principal = %q, want %q", principal, tt.keyID)
+		}
+	}
+}
+
+func TestHMACInvalid(t *testing.T) {
+	a := NewHMACAuthenticator(testKeys, time.Minute)
+	now := time.Now().Unix()
+
+	wantUnauthenticated(t, a, &Option{}, "missing credentials")
+	wantUnauthenticated(t, a, hmacOption("k3", []byte("secret-3"), "n", now), "invalid hmac credentials")
+	wantUnauthenticated(t, a, hmacOption("k1", testKeys["k1"], "", now), "invalid hmac credentials")
+
+	// 使用其他密钥签名、篡改签名的字段
+	wantUnauthenticated(t, a, hmacOption("k1", testKeys["k2"], "n1", now), "invalid hmac signature")
+	opt := hmacOption("k1", testKeys["k1"], "n2", now)
+	opt.Credentials.Nonce = "n3"
+	wantUnauthenticated(t, a, opt, "invalid hmac signature")
+	opt = hmacOption("k1", testKeys["k1"], "n4", now)
+	opt.Credentials.Timestamp++
+	wantUnauthenticated(t, a, opt, "invalid hmac signature")
+	opt = hmacOption("k1", testKeys["k1"], "n5", now)
+	opt.Credentials.KeyID = "k2"
+	wantUnauthenticated(t, a, opt, "invalid hmac signature")
+}
+
+// 签名时间与服务端时间相差超过maxSkew
+func TestHMACExpired(t *testing.T) {
+	a := NewHMACAuthenticator(testKeys, time.Minute)
+	now := time.Now().Unix()
+	wantUnauthenticated(t, a, hmacOption("k1", testKeys["k1"], "old", now-120), "expired")
+	wantUnauthenticated(t, a, hmacOption("k1", testKeys["k1"], "future", now+120), "expired")
+	if len(a.nonces) != 0 {
+		t.Fatalf("rejected nonces recorded: %v", a.nonces)
+	}
+}
+
+func TestHMACReplay(t *testing.T) {
+	a := NewHMACAuthenticator(testKeys, time.Minute)
+	now := time.Now().Unix()
+	opt := hmacOption("k1", testKeys["k1"], "once", now)
+	if _, err := a.Authenticate(context.Background(), opt); err != nil {
+		t.Fatal(err)
+	}
+	wantUnauthenticated(t, a, opt, "nonce reused")
+	// 重新签名同一个nonce同样被拒绝
+	wantUnauthenticated(t, a, hmacOption("k1", testKeys["k1"], "once", now-1), "nonce reused")
+
+	// nonce按KeyID区分
+	if _, err := a.Authenticate(context.Background(), hmacOption("k2", testKeys["k2"], "once", now)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 堆顶始终是最早过期的nonce
+func TestNonceHeapOrder(t *testing.T) {
+	var h nonceHeap
+	base := time.Now()
+	r := rand.New(rand.NewSource(1))
+	for _, i := range r.Perm(100) {
+		heap.Push(&h, nonceEntry{id: strconv.Itoa(i), expire: base.Add(time.Duration(i) * time.Second)})
+	}
+	for i := 0; i < 100; i++ {
+		e := heap.Pop(&h).(nonceEntry)
+		if e.id != strconv.Itoa(i) {
+			t.Fatalf("pop %d got %s", i, e.id)
+		}
+	}
+}
+
+// 校验时只清理已过期的nonce，按过期时间从早到晚清理，未过期的nonce仍然不能重复使用
+func TestHMACNonceEviction(t *testing.T) {
+	a := NewHMACAuthenticator(testKeys, time.Minute)
+	now := time.Now()
+	for _, e := range []struct {
+		id     string
+		offset time.Duration
+	}{
+		{"k1\nlive-2", 2 * time.Hour},
+		{"k1\nexpired-3", -3 * time.Second},
+		{"k1\nlive-1", time.Hour},
+		{"k1\nexpired-1", -time.Second},
+		{"k1\nexpired-2", -2 * time.Second},
+	} {
+		a.nonces[e.id] = struct{}{}
+		heap.Push(&a.expiry, nonceEntry{id: e.id, expire: now.Add(e.offset)})
+	}
+
+	opt := hmacOption("k1", testKeys["k1"], "fresh", now.Unix())
+	if _, err := a.Authenticate(context.Background(), opt); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"k1\nexpired-1", "k1\nexpired-2", "k1\nexpired-3"} {
+		if _, ok := a.nonces[id]; ok {
+			t.Fatalf("expired nonce %q not evicted", strings.Replace(id, "\n", " ", 1))
+		}
+	}
+	if len(a.nonces) != 3 || len(a.expiry) != 3 {
+		t.Fatalf("%d nonces, %d heap entries after eviction, want 3", len(a.nonces), len(a.expiry))
+	}
+	var order []string
+	for len(a.expiry) > 0 {
+		order = append(order, heap.Pop(&a.expiry).(nonceEntry).id)
+	}
+	if want := []string{"k1\nfresh", "k1\nlive-1", "k1\nlive-2"}; strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Fatalf("remaining order %q, want %q", order, want)
+	}
+}
+
+func TestTokenAuthenticator(t *testing.T) {
+	a := TokenAuthenticator{"t1": "alice", "t2": "bob"}
+	principal, err := a.Authenticate(context.Background(), &Option{Credentials: &Credentials{Token: "t2"}})
+	if err != nil || principal != "bob" {
+		t.Fatalf("Authenticate = %q, %v, want bob", principal, err)
+	}
+	wantUnauthenticated(t, a, &Option{Credentials: &Credentials{Token: "t3"}}, "invalid token")
+	wantUnauthenticated(t, a, &Option{}, "missing credentials")
+}
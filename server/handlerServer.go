@@ -2,16 +2,28 @@ package server
 
 import (
 	"TinyRPC/codec"
+	"TinyRPC/metadata"
+	"TinyRPC/network"
+	"TinyRPC/peer"
 	"TinyRPC/reactor"
+	"TinyRPC/status"
+	"context"
 	"errors"
 	"golang.org/x/sys/unix"
 	"log"
 	"reflect"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
 )
 
 // Option 协商报文
 type Option struct {
-	CodecType codec.Type // 客户端所使用的序列化方式
+	CodecType       codec.Type          // 客户端所使用的序列化方式
+	Compression     network.Compression // 帧体压缩方式，为空不压缩，可选gzip、flate
+	CompressMinSize int                 // 压缩阈值，帧体长度不小于该值时压缩，不大于0时使用network.DefaultCompressMinSize
+	Credentials     *Credentials        // 客户端凭证，服务端设置了Authenticator时校验
+	Identity        string              // 客户端声明的身份，如服务名，可用于访问控制，未经校验
 }
 
 // SelectCodec 用于handler池处理用户选择序列化方式
@@ -30,6 +42,28 @@ func (server *Server) SelectCodec(t *reactor.HandlerReadTask) error {
 		return errors.New("close")
 	}
 
+	// 对端信息保存到连接的context中，方法通过peer.FromContext获取
+	t.Ctx = peer.NewContext(t.Ctx, &peer.Peer{Addr: c.RemoteAddr(), TLS: c.TLSState()})
+
+	if opt.Identity != "" {
+		t.Ctx = newIdentityContext(t.Ctx, opt.Identity)
+	}
+
+	// 鉴权失败时不创建序列化器，直接关闭连接
+	if a := server.getAuthenticator(); a != nil {
+		principal, err := a.Authenticate(t.Ctx, &opt)
+		if err != nil {
+			log.Printf("rpc server: authenticate %v failed: %v\n", c.RemoteAddr(), err)
+			return err
+		}
+		t.Ctx = newPrincipalContext(t.Ctx, principal)
+	}
+
+	// 之后的帧按协商的方式压缩
+	if err := c.SetCompression(opt.Compression, opt.CompressMinSize); err != nil {
+		return err
+	}
+
 	t.C = f(c) // 反序列化实例，一个连接的共享一个，因为部分序列化程序需要上下文信息，比如gob
 	return nil
 }
@@ -45,15 +79,32 @@ func (server *Server) ServerCodec(t *reactor.HandlerReadTask) (req *reactor.Requ
 	if err = c.ReadHeader(&header); err != nil {
 		if err != unix.EAGAIN && err.Error() != "close" {
 			// 致命错误
-			header.Error = "rpc server: read header error: " + err.Error()
+			setError(&header, status.New(status.Internal, "rpc server: read header error: "+err.Error()))
 		}
 		return
 	}
 
-	// 查找服务和方法
+	// 请求的context由连接的context派生，连接被移除或超时时取消，截止时间按服务端收到请求的时间计算
+	if header.Timeout > 0 {
+		req.Ctx, req.Cancel = context.WithTimeout(t.Ctx, time.Duration(header.Timeout))
+	} else {
+		req.Ctx, req.Cancel = context.WithCancel(t.Ctx)
+	}
+	if len(header.Metadata) > 0 {
+		req.Ctx = metadata.NewIncomingContext(req.Ctx, header.Metadata)
+	}
+
+	// 查找服务和方法，并检查调用方能否调用
 	s, method, err := server.findService(header.ServiceMethod)
+	if err == nil {
+		err = server.checkACL(req.Ctx, header.ServiceMethod)
+	}
 	if err != nil {
-		header.Error = err.Error()
+		setError(&header, err)
+		// 丢弃请求参数，保证下一个请求能正确反序列化
+		if err = c.ReadBody(nil); err != nil {
+			return
+		}
 		return req, nil // 非致命错误
 	}
 
@@ -70,10 +121,16 @@ func (server *Server) ServerCodec(t *reactor.HandlerReadTask) (req *reactor.Requ
 	if err = c.ReadBody(argi); err != nil {
 		if err != unix.EAGAIN && err.Error() != "close" {
 			// 致命错误
-			header.Error = "rpc server: read argv error: " + err.Error()
+			setError(&header, status.New(status.InvalidArgument, "rpc server: read argv error: "+err.Error()))
 		}
 		return
 	}
+
+	// 超过限流时直接返回错误，不交给worker池
+	if req.Release, err = server.acquire(s.Name, header.ServiceMethod); err != nil {
+		setError(&header, err)
+		return req, nil // 非致命错误
+	}
 	return
 }
 
@@ -98,25 +155,108 @@ func newReplyv(method *reactor.MethodType) reflect.Value {
 	return replyv
 }
 
-// HandleRequest 用于worker池处理业务逻辑
-func (server *Server) HandleRequest(handle *reactor.WorkerTask, handlerWriteTask chan *reactor.WorkerTask) {
+// HandleRequest 用于worker池处理业务逻辑，结果写入请求的header和replyv，由reactor交给writer发送
+func (server *Server) HandleRequest(handle *reactor.WorkerTask) {
 	if handle.Req.H.Error != "" {
-		handlerWriteTask <- handle
 		return
 	}
-	f := handle.Req.Mtype.Method.Func
-
-	returnValues := f.Call([]reflect.Value{handle.Req.S.Rcvr, handle.Req.Argv, handle.Req.Replyv})
-	if errInter := returnValues[0].Interface(); errInter != nil {
-		handle.Req.H.Error = errInter.(error).Error()
-		handlerWriteTask <- handle
+	// 请求在排队期间已超过截止时间或客户端已断开，不再调用方法
+	if err := handle.Req.Ctx.Err(); err != nil {
+		setError(handle.Req.H, status.New(status.Convert(err).Code, "rpc server: "+err.Error()))
 		return
 	}
-	handlerWriteTask <- handle
+	if err := server.call(handle.Req); err != nil {
+		setError(handle.Req.H, err)
+	}
+}
+
+// RejectRequest 用于reactor拒绝请求（如过载），err作为请求的错误信息发送给客户端
+func (server *Server) RejectRequest(req *reactor.Request, err error) {
+	setError(req.H, err)
+}
+
+// 依次调用拦截器及注册的方法，panic时转换为错误返回，worker goroutine继续处理其他请求
+func (server *Server) call(req *reactor.Request) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			atomic.AddUint64(&server.panics, 1)
+			log.Printf("rpc server: %s panic: %v\n%s", req.H.ServiceMethod, r, stack)
+			if h, _ := server.panicHandler.Load().(PanicHandler); h != nil {
+				h(req.H.ServiceMethod, r, stack)
+			}
+			err = status.Newf(status.Internal, "rpc server: %s panic: %v", req.H.ServiceMethod, r)
+		}
+	}()
+
+	h := server.chain(newMethodInfo(req.H.ServiceMethod), func(ctx context.Context, argv, replyv interface{}) error {
+		// 使用拦截器传入的参数调用方法，拦截器可以替换argv、replyv
+		av, rv, err := methodArgs(req.Mtype, argv, replyv)
+		if err != nil {
+			return err
+		}
+		f := req.Mtype.Method.Func
+		var returnValues []reflect.Value
+		if req.Mtype.HasCtx {
+			returnValues = f.Call([]reflect.Value{req.S.Rcvr, reflect.ValueOf(ctx), av, rv})
+		} else {
+			returnValues = f.Call([]reflect.Value{req.S.Rcvr, av, rv})
+		}
+		if errInter := returnValues[0].Interface(); errInter != nil {
+			return errInter.(error)
+		}
+		return nil
+	})
+	return h(req.Ctx, req.Argv.Interface(), req.Replyv.Interface())
+}
+
+// 将拦截器传给Handler的argv、replyv转换为方法参数，argv可以是ArgType或指向ArgType的指针，replyv必须是ReplyType
+func methodArgs(mtype *reactor.MethodType, argv, replyv interface{}) (av, rv reflect.Value, err error) {
+	av = reflect.ValueOf(argv)
+	switch {
+	case !av.IsValid():
+		av = reflect.Zero(mtype.ArgType)
+		if mtype.ArgType.Kind() != reflect.Ptr && mtype.ArgType.Kind() != reflect.Interface &&
+			mtype.ArgType.Kind() != reflect.Map && mtype.ArgType.Kind() != reflect.Slice {
+			return av, rv, status.Newf(status.Internal, "rpc server: argv is nil, want %s", mtype.ArgType)
+		}
+	case av.Type() == mtype.ArgType:
+	case av.Kind() == reflect.Ptr && av.Type().Elem() == mtype.ArgType && !av.IsNil():
+		av = av.Elem()
+	default:
+		return av, rv, status.Newf(status.Internal, "rpc server: argv type %s, want %s", av.Type(), mtype.ArgType)
+	}
+
+	rv = reflect.ValueOf(replyv)
+	if !rv.IsValid() || rv.Type() != mtype.ReplyType || rv.IsNil() {
+		return av, rv, status.Newf(status.Internal, "rpc server: replyv type %T, want %s", replyv, mtype.ReplyType)
+	}
+	return av, rv, nil
+}
+
+// 将错误转换为状态码写入header，发送给客户端
+func setError(h *codec.Header, err error) {
+	st := status.Convert(err)
+	h.Error = st.Message
+	if h.Error == "" { // header.Error为空表示没有错误
+		h.Error = st.Code.String()
+	}
+	h.Code = uint32(st.Code)
+	h.Details = st.Details
 }
 
 // SendResponse 用于handlerWriter池发送响应
 func (server *Server) SendResponse(handle *reactor.WorkerTask) (err error) {
+	if handle.Req.Cancel != nil {
+		defer handle.Req.Cancel()
+	}
+	if handle.Req.Release != nil {
+		defer handle.Req.Release()
+	}
+	// 超时时间与元数据只随请求发送，响应不需要
+	handle.Req.H.Timeout = 0
+	handle.Req.H.Metadata = nil
+
 	var reply interface{}
 	if handle.Req.H.Error == "" {
 		reply = handle.Req.Replyv.Interface()
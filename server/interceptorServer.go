@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"strings"
+)
+
+// MethodInfo 拦截器获取的请求方法信息
+type MethodInfo struct {
+	ServiceMethod string // 请求方法，格式为 Service.Method
+	Service       string // 服务名称
+	Method        string // 方法名称
+}
+
+// Handler 调用下一个拦截器，最后一个拦截器调用的是注册的方法
+type Handler func(ctx context.Context, argv, replyv interface{}) error
+
+// UnaryServerInterceptor 服务端拦截器，在反序列化请求后、调用方法前执行
+// 调用next继续处理请求，不调用next时返回的err直接发送给客户端
+// argv为请求参数，replyv为响应值的指针，调用next时可以传入替换后的argv（类型相同或其指针）、replyv，方法使用传入的值
+// 发送给客户端的是最外层的replyv
+type UnaryServerInterceptor func(ctx context.Context, info *MethodInfo, argv, replyv interface{}, next Handler) error
+
+// Use 添加拦截器，先添加的拦截器先执行
+func (server *Server) Use(interceptors ...UnaryServerInterceptor) {
+	server.interceptorsMu.Lock()
+	defer server.interceptorsMu.Unlock()
+
+	// 写时复制，处理请求时读取拦截器列表不需要加锁
+	old, _ := server.interceptors.Load().([]UnaryServerInterceptor)
+	chain := make([]UnaryServerInterceptor, 0, len(old)+len(interceptors))
+	chain = append(chain, old...)
+	chain = append(chain, interceptors...)
+	server.interceptors.Store(chain)
+}
+
+// 将拦截器与最终调用的方法组合成一个Handler
+func (server *Server) chain(info *MethodInfo, final Handler) Handler {
+	interceptors, _ := server.interceptors.Load().([]UnaryServerInterceptor)
+	h := final
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(ctx context.Context, argv, replyv interface{}) error {
+			return interceptor(ctx, info, argv, replyv, next)
+		}
+	}
+	return h
+}
+
+func newMethodInfo(serviceMethod string) *MethodInfo {
+	info := &MethodInfo{ServiceMethod: serviceMethod}
+	if dot := strings.LastIndex(serviceMethod, "."); dot != -1 {
+		info.Service, info.Method = serviceMethod[:dot], serviceMethod[dot+1:]
+	}
+	return info
+}
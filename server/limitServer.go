@@ -0,0 +1,160 @@
+package server
+
+import (
+	"TinyRPC/status"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 限流，请求反序列化后、交给worker池之前检查，超过限制时直接返回ResourceExhausted，不占用worker
+
+// Limit 限流配置，字段为零值时不限制
+type Limit struct {
+	Rate        float64 // 令牌桶每秒生成的令牌数，即每秒允许的请求数
+	Burst       int     // 令牌桶容量，允许的突发请求数，不大于0时为Rate向上取整（至少为1）
+	MaxInFlight int     // 同时处理的最大请求数，请求在发送响应后结束
+}
+
+// 一个服务或方法的限流状态
+type limiter struct {
+	mu       sync.Mutex // 保护limit、tokens、last
+	limit    Limit
+	tokens   float64   // 当前令牌数
+	last     time.Time // 上次生成令牌的时间
+	inflight int64     // 正在处理的请求数，未限制并发时也计数，运行中修改MaxInFlight后仍然准确
+}
+
+func newLimiter(l Limit) *limiter {
+	l = parseLimit(l)
+	return &limiter{
+		limit:  l,
+		tokens: float64(l.Burst),
+		last:   time.Now(),
+	}
+}
+
+// 填充未设置的Burst
+func parseLimit(l Limit) Limit {
+	if l.Rate > 0 && l.Burst <= 0 {
+		l.Burst = int(math.Max(1, math.Ceil(l.Rate)))
+	}
+	return l
+}
+
+// SetLimit 设置服务（name为"Service"）或方法（name为"Service.Method"）的限流，运行中调用立即生效
+// 请求需要同时满足服务和方法的限流；已有限流时原地修改配置，保留正在处理的请求数和剩余令牌
+func (server *Server) SetLimit(name string, l Limit) {
+	server.updateLimits(func(limits map[string]*limiter) {
+		if old, ok := limits[name]; ok {
+			old.update(l)
+			return
+		}
+		limits[name] = newLimiter(l)
+	})
+}
+
+// RemoveLimit 取消服务或方法的限流，之后再次设置时重新计数
+func (server *Server) RemoveLimit(name string) {
+	server.updateLimits(func(limits map[string]*limiter) {
+		delete(limits, name)
+	})
+}
+
+// 写时复制，处理请求时读取限流配置不需要加锁
+func (server *Server) updateLimits(update func(map[string]*limiter)) {
+	server.limitsMu.Lock()
+	defer server.limitsMu.Unlock()
+
+	old, _ := server.limits.Load().(map[string]*limiter)
+	limits := make(map[string]*limiter, len(old)+1)
+	for name, l := range old {
+		limits[name] = l
+	}
+	update(limits)
+	server.limits.Store(limits)
+}
+
+// 依次检查服务和方法的限流，通过时返回请求结束后需要调用的release，没有限流时release为nil
+func (server *Server) acquire(service, serviceMethod string) (release func(), err error) {
+	limits, _ := server.limits.Load().(map[string]*limiter)
+	if len(limits) == 0 {
+		return nil, nil
+	}
+
+	var acquired []*limiter
+	for _, name := range [...]string{service, serviceMethod} {
+		l := limits[name]
+		if l == nil {
+			continue
+		}
+		if err = l.acquire(name); err != nil {
+			for _, a := range acquired {
+				a.release()
+			}
+			return nil, err
+		}
+		acquired = append(acquired, l)
+	}
+	if len(acquired) == 0 {
+		return nil, nil
+	}
+	return func() {
+		for _, a := range acquired {
+			a.release()
+		}
+	}, nil
+}
+
+// 修改限流配置，令牌数不超过新的容量，之前未限制速率时令牌桶从满开始
+func (l *limiter) update(limit Limit) {
+	limit = parseLimit(limit)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit.Rate <= 0 {
+		l.tokens = float64(limit.Burst)
+		l.last = time.Now()
+	}
+	l.limit = limit
+	l.tokens = math.Min(l.tokens, float64(limit.Burst))
+}
+
+func (l *limiter) acquire(name string) error {
+	l.mu.Lock()
+	limit := l.limit
+	l.mu.Unlock()
+
+	if n := atomic.AddInt64(&l.inflight, 1); limit.MaxInFlight > 0 && n > int64(limit.MaxInFlight) {
+		atomic.AddInt64(&l.inflight, -1)
+		return status.Newf(status.ResourceExhausted, "rpc server: %s too many requests in flight", name)
+	}
+	if limit.Rate > 0 && !l.take() {
+		atomic.AddInt64(&l.inflight, -1)
+		return status.Newf(status.ResourceExhausted, "rpc server: %s rate limit exceeded", name)
+	}
+	return nil
+}
+
+func (l *limiter) release() {
+	atomic.AddInt64(&l.inflight, -1)
+}
+
+// 按经过的时间补充令牌后取走一个令牌，配置已改为不限制速率时直接通过
+func (l *limiter) take() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit.Rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.tokens = math.Min(float64(l.limit.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limit.Rate)
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
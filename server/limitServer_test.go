@@ -0,0 +1,224 @@
+package server
+
+import (
+	"TinyRPC/status"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 获取n次限流，返回每次的release，任一次失败时测试失败
+func mustAcquire(t *testing.T, s *Server, service, serviceMethod string, n int) []func() {
+	t.Helper()
+	var releases []func()
+	for i := 0; i < n; i++ {
+		release, err := s.acquire(service, serviceMethod)
+		if err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+		releases = append(releases, release)
+	}
+	return releases
+}
+
+func wantExhausted(t *testing.T, s *Server, service, serviceMethod string) {
+	t.Helper()
+	release, err := s.acquire(service, serviceMethod)
+	if err == nil {
+		release()
+		t.Fatal("acquire succeeded, want ResourceExhausted")
+	}
+	if code := status.Convert(err).Code; code != status.ResourceExhausted {
+		t.Fatalf("code = %v, want ResourceExhausted", code)
+	}
+}
+
+func inflight(s *Server, name string) int64 {
+	limits, _ := s.limits.Load().(map[string]*limiter)
+	return atomic.LoadInt64(&limits[name].inflight)
+}
+
+func TestLimitNone(t *testing.T) {
+	s := New()
+	release, err := s.acquire("Arith", "Arith.Add")
+	if err != nil || release != nil {
+		t.Fatalf("acquire without limits = %v, %v", release != nil, err)
+	}
+	s.SetLimit("Other", Limit{MaxInFlight: 1})
+	if release, err = s.acquire("Arith", "Arith.Add"); err != nil || release != nil {
+		t.Fatalf("acquire with unrelated limit = %v, %v", release != nil, err)
+	}
+}
+
+func TestLimitMaxInFlight(t *testing.T) {
+	s := New()
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 2})
+
+	releases := mustAcquire(t, s, "Arith", "Arith.Add", 2)
+	wantExhausted(t, s, "Arith", "Arith.Add")
+	// 其他方法不受影响
+	mustAcquire(t, s, "Arith", "Arith.Mul", 3)
+
+	releases[0]()
+	releases = append(releases[1:], mustAcquire(t, s, "Arith", "Arith.Add", 1)...)
+	for _, release := range releases {
+		release()
+	}
+	if n := inflight(s, "Arith.Add"); n != 0 {
+		t.Fatalf("inflight = %d after release, want 0", n)
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	s := New()
+	s.SetLimit("Arith", Limit{Rate: 20, Burst: 2})
+
+	mustAcquire(t, s, "Arith", "Arith.Add", 2)
+	wantExhausted(t, s, "Arith", "Arith.Mul")
+	time.Sleep(60 * time.Millisecond) // 每50ms生成一个令牌
+	mustAcquire(t, s, "Arith", "Arith.Mul", 1)
+	wantExhausted(t, s, "Arith", "Arith.Add")
+
+	// 速率被拒绝的请求不占用并发数
+	if n := inflight(s, "Arith"); n != 3 {
+		t.Fatalf("inflight = %d, want 3", n)
+	}
+}
+
+func TestLimitDefaultBurst(t *testing.T) {
+	for _, tt := range []struct {
+		rate  float64
+		burst int
+	}{{0.5, 1}, {1, 1}, {2.5, 3}, {100, 100}} {
+		if l := newLimiter(Limit{Rate: tt.rate}); l.limit.Burst != tt.burst {
+			t.Errorf("Rate %v: Burst = %d, want %d", tt.rate, l.limit.Burst, tt.burst)
+		}
+	}
+}
+
+// 方法的限流拒绝时释放已获取的服务限流
+func TestLimitServiceAndMethod(t *testing.T) {
+	s := New()
+	s.SetLimit("Arith", Limit{MaxInFlight: 3})
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 1})
+
+	release := mustAcquire(t, s, "Arith", "Arith.Add", 1)[0]
+	wantExhausted(t, s, "Arith", "Arith.Add")
+	if n := inflight(s, "Arith"); n != 1 {
+		t.Fatalf("service inflight = %d after method rejected, want 1", n)
+	}
+	mustAcquire(t, s, "Arith", "Arith.Mul", 2)
+	wantExhausted(t, s, "Arith", "Arith.Mul")
+
+	release()
+	if n := inflight(s, "Arith.Add"); n != 0 {
+		t.Fatalf("method inflight = %d, want 0", n)
+	}
+	if n := inflight(s, "Arith"); n != 2 {
+		t.Fatalf("service inflight = %d, want 2", n)
+	}
+}
+
+// 请求处理期间修改限流，正在处理的请求仍然计数，释放后计数归零
+func TestLimitReloadInFlight(t *testing.T) {
+	s := New()
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 2})
+	releases := mustAcquire(t, s, "Arith", "Arith.Add", 2)
+
+	// 调低上限后，已有2个请求在处理，新请求被拒绝
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 1})
+	wantExhausted(t, s, "Arith", "Arith.Add")
+	releases[0]()
+	wantExhausted(t, s, "Arith", "Arith.Add")
+	releases[1]()
+	releases = mustAcquire(t, s, "Arith", "Arith.Add", 1)
+	wantExhausted(t, s, "Arith", "Arith.Add")
+
+	// 调高上限
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 3})
+	releases = append(releases, mustAcquire(t, s, "Arith", "Arith.Add", 2)...)
+	wantExhausted(t, s, "Arith", "Arith.Add")
+
+	// 取消并发限制后仍然计数，再次限制时按正在处理的请求数判断
+	s.SetLimit("Arith.Add", Limit{Rate: 1000})
+	releases = append(releases, mustAcquire(t, s, "Arith", "Arith.Add", 1)...)
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 4})
+	wantExhausted(t, s, "Arith", "Arith.Add")
+
+	for _, release := range releases {
+		release()
+	}
+	if n := inflight(s, "Arith.Add"); n != 0 {
+		t.Fatalf("inflight = %d after release, want 0", n)
+	}
+	mustAcquire(t, s, "Arith", "Arith.Add", 4)
+	wantExhausted(t, s, "Arith", "Arith.Add")
+}
+
+// 并发请求期间反复修改限流，所有请求结束后计数归零
+func TestLimitReloadConcurrent(t *testing.T) {
+	s := New()
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 4})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if release, err := s.acquire("Arith", "Arith.Add"); err == nil {
+					time.Sleep(time.Millisecond)
+					release()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		s.SetLimit("Arith.Add", Limit{MaxInFlight: 1 + i%6, Rate: float64(1000 * (i % 2))})
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+
+	if n := inflight(s, "Arith.Add"); n != 0 {
+		t.Fatalf("inflight = %d after all requests finished, want 0", n)
+	}
+}
+
+// 修改速率时保留剩余令牌，令牌数不超过新的容量
+func TestLimitReloadRate(t *testing.T) {
+	s := New()
+	s.SetLimit("Arith", Limit{Rate: 1, Burst: 5})
+	mustAcquire(t, s, "Arith", "Arith.Add", 1)
+
+	s.SetLimit("Arith", Limit{Rate: 1, Burst: 2})
+	mustAcquire(t, s, "Arith", "Arith.Add", 2)
+	wantExhausted(t, s, "Arith", "Arith.Add")
+
+	// 之前不限制速率时令牌桶从满开始
+	s.SetLimit("Arith.Mul", Limit{MaxInFlight: 10})
+	s.SetLimit("Arith.Mul", Limit{MaxInFlight: 10, Rate: 1, Burst: 3})
+	s.SetLimit("Arith", Limit{})
+	mustAcquire(t, s, "Arith", "Arith.Mul", 3)
+	wantExhausted(t, s, "Arith", "Arith.Mul")
+}
+
+func TestLimitRemove(t *testing.T) {
+	s := New()
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 1})
+	release := mustAcquire(t, s, "Arith", "Arith.Add", 1)[0]
+	s.RemoveLimit("Arith.Add")
+	mustAcquire(t, s, "Arith", "Arith.Add", 2)
+	release() // 释放已移除的限流不影响新的限流
+
+	s.SetLimit("Arith.Add", Limit{MaxInFlight: 1})
+	mustAcquire(t, s, "Arith", "Arith.Add", 1)
+	wantExhausted(t, s, "Arith", "Arith.Add")
+}
@@ -2,17 +2,47 @@ package server
 
 import (
 	"TinyRPC/reactor"
-	"errors"
+	"TinyRPC/status"
+	"context"
 	"go/ast"
 	"log"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Server 服务端实例
 type Server struct {
-	serviceMap sync.Map // 用于保存已注册的服务 map[服务名称]*reactor.Service
+	serviceMap sync.Map        // 用于保存已注册的服务 map[服务名称]*reactor.Service
+	engine     *reactor.Engine // 运行中的reactor实例，用于关闭服务端
+	closed     bool            // 已调用Shutdown/Close
+	mu         sync.Mutex      // 保护engine、closed
+
+	panicHandler atomic.Value // PanicHandler，业务方法panic时调用
+	panics       uint64       // 业务方法panic的次数
+
+	interceptors   atomic.Value // []UnaryServerInterceptor，服务端拦截器
+	interceptorsMu sync.Mutex   // 保证Use串行修改拦截器列表
+
+	authenticator atomic.Value // *Authenticator，连接鉴权
+	acl           atomic.Value // *ACL，访问控制策略
+
+	limits   atomic.Value // map[string]*limiter，服务和方法的限流
+	limitsMu sync.Mutex   // 保证SetLimit、RemoveLimit串行修改限流配置
+}
+
+// PanicHandler 业务方法panic时调用，r为recover的返回值，stack为panic时的调用栈
+type PanicHandler func(serviceMethod string, r interface{}, stack []byte)
+
+// SetPanicHandler 设置业务方法panic时的回调，可用于上报调用栈
+func (server *Server) SetPanicHandler(h PanicHandler) {
+	server.panicHandler.Store(h)
+}
+
+// Panics 返回业务方法panic的次数
+func (server *Server) Panics() uint64 {
+	return atomic.LoadUint64(&server.panics)
 }
 
 // New 创建服务端，需要调用Register注册RPC方法
@@ -38,17 +68,24 @@ func (server *Server) Register(rcvr interface{}) {
 		method := s.Typ.Method(i)
 
 		// 查找结构体中符合规则的方法
+		// func (T) Method(Args, *Reply) error 或 func (T) Method(context.Context, Args, *Reply) error
+		hasCtx := method.Type.NumIn() == 4 && method.Type.In(1) == typeOfContext
+		argIndex := 1
+		if hasCtx {
+			argIndex = 2
+		}
 		if !ast.IsExported(method.Name) ||
-			method.Type.NumIn() != 3 || method.Type.NumOut() != 1 ||
-			method.Type.Out(0) != reflect.TypeOf((*error)(nil)).Elem() ||
-			!isExportedOrBuiltinType(method.Type.In(1)) || !isExportedOrBuiltinType(method.Type.In(2)) {
+			method.Type.NumIn() != argIndex+2 || method.Type.NumOut() != 1 ||
+			method.Type.Out(0) != typeOfError ||
+			!isExportedOrBuiltinType(method.Type.In(argIndex)) || !isExportedOrBuiltinType(method.Type.In(argIndex+1)) {
 			continue
 		}
 
 		s.Method[method.Name] = &reactor.MethodType{
 			Method:    method,
-			ArgType:   method.Type.In(1),
-			ReplyType: method.Type.In(2),
+			HasCtx:    hasCtx,
+			ArgType:   method.Type.In(argIndex),
+			ReplyType: method.Type.In(argIndex + 1),
 		}
 		log.Printf("rpc server: register %s.%s", s.Name, method.Name)
 	}
@@ -58,6 +95,11 @@ func (server *Server) Register(rcvr interface{}) {
 	}
 }
 
+var (
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
 func isExportedOrBuiltinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
@@ -66,20 +108,20 @@ func isExportedOrBuiltinType(t reflect.Type) bool {
 func (server *Server) findService(serviceMethod string) (s *reactor.Service, method *reactor.MethodType, err error) {
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot == -1 {
-		err = errors.New("rpc server: service/method request ill-formed: " + serviceMethod)
+		err = status.New(status.InvalidArgument, "rpc server: service/method request ill-formed: "+serviceMethod)
 		return
 	}
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
 	si, ok := server.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("rpc server: can't find service " + serviceName)
+		err = status.New(status.NotFound, "rpc server: can't find service "+serviceName)
 		return
 	}
 	s = si.(*reactor.Service)
 
 	method, ok = s.Method[methodName]
 	if !ok {
-		err = errors.New("rpc server: can't find method" + serviceMethod)
+		err = status.New(status.NotFound, "rpc server: can't find method "+serviceMethod)
 	}
 	return
 }
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"TinyRPC/reactor"
+	"context"
+	"errors"
+)
+
+// ErrServerClosed 调用Shutdown/Close后，Serve返回此错误
+var ErrServerClosed = errors.New("rpc server: server closed")
+
+// Serve 在addr上启动reactor，阻塞直到调用Shutdown/Close或出现错误
+// opts为reactor拓扑配置，未传入时使用reactor.DefaultReactorOptions
+func (server *Server) Serve(addr string, opts ...*reactor.ReactorOptions) error {
+	if err := server.Listen(addr, opts...); err != nil {
+		return err
+	}
+	return server.Run()
+}
+
+// Listen 在addr上创建监听套接字，地址解析、绑定失败时返回错误，需要调用Run开始处理连接
+// addr可以是IPv4、IPv6地址或主机名，如"127.0.0.1:9991"、"[::1]:9991"、"localhost:9991"，":9991"监听所有网卡
+func (server *Server) Listen(addr string, opts ...*reactor.ReactorOptions) error {
+	var opt *reactor.ReactorOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	e, err := reactor.NewEngine(addr, server, opt)
+	if err != nil {
+		return err
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.closed {
+		_ = e.Close()
+		return ErrServerClosed
+	}
+	if server.engine != nil {
+		_ = e.Close()
+		return errors.New("rpc server: already listening")
+	}
+	server.engine = e
+	return nil
+}
+
+// Run 启动Listen创建的reactor，阻塞直到调用Shutdown/Close或出现错误
+func (server *Server) Run() error {
+	server.mu.Lock()
+	e := server.engine
+	server.mu.Unlock()
+	if e == nil {
+		return errors.New("rpc server: Run called before Listen")
+	}
+
+	if err := e.Run(); err != reactor.ErrEngineClosed {
+		return err
+	}
+	return ErrServerClosed
+}
+
+// Shutdown 优雅关闭服务端：停止接收新连接和新请求，等待已接收的请求处理完成并发送响应后关闭所有连接
+// ctx结束时不再等待，强制关闭所有连接并返回ctx.Err()
+func (server *Server) Shutdown(ctx context.Context) error {
+	e := server.markClosed()
+	if e == nil {
+		return nil
+	}
+	if err := e.Shutdown(ctx); err != reactor.ErrEngineClosed {
+		return err
+	}
+	return nil
+}
+
+// Close 立即关闭服务端，不等待正在处理的请求
+func (server *Server) Close() error {
+	e := server.markClosed()
+	if e == nil {
+		return nil
+	}
+	if err := e.Close(); err != reactor.ErrEngineClosed {
+		return err
+	}
+	return nil
+}
+
+func (server *Server) markClosed() *reactor.Engine {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.closed = true
+	return server.engine
+}
+
+// Shed 返回因过载被拒绝的请求数，见reactor.ReactorOptions.ShedTarget
+func (server *Server) Shed() uint64 {
+	server.mu.Lock()
+	e := server.engine
+	server.mu.Unlock()
+	if e == nil {
+		return 0
+	}
+	return e.Shed()
+}
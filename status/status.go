@@ -0,0 +1,122 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// 携带状态码的RPC错误，状态码、错误信息、详情通过codec.Header发送给客户端
+
+// Code 状态码
+type Code uint32
+
+const (
+	OK                 Code = iota // 成功
+	Canceled                       // 请求被取消
+	Unknown                        // 未知错误，方法返回的普通error使用此状态码
+	InvalidArgument                // 参数错误，如请求格式错误、参数无法反序列化
+	DeadlineExceeded               // 超过截止时间
+	NotFound                       // 服务或方法不存在
+	AlreadyExists                  // 资源已存在
+	PermissionDenied               // 没有权限
+	ResourceExhausted              // 资源耗尽，如被限流
+	FailedPrecondition             // 不满足执行条件
+	Aborted                        // 操作被中止
+	OutOfRange                     // 超出范围
+	Unimplemented                  // 未实现
+	Internal                       // 内部错误，如方法panic
+	Unavailable                    // 服务不可用，如连接断开、服务端过载
+	DataLoss                       // 数据丢失
+	Unauthenticated                // 未认证
+)
+
+var codeNames = [...]string{
+	OK:                 "OK",
+	Canceled:           "Canceled",
+	Unknown:            "Unknown",
+	InvalidArgument:    "InvalidArgument",
+	DeadlineExceeded:   "DeadlineExceeded",
+	NotFound:           "NotFound",
+	AlreadyExists:      "AlreadyExists",
+	PermissionDenied:   "PermissionDenied",
+	ResourceExhausted:  "ResourceExhausted",
+	FailedPrecondition: "FailedPrecondition",
+	Aborted:            "Aborted",
+	OutOfRange:         "OutOfRange",
+	Unimplemented:      "Unimplemented",
+	Internal:           "Internal",
+	Unavailable:        "Unavailable",
+	DataLoss:           "DataLoss",
+	Unauthenticated:    "Unauthenticated",
+}
+
+func (c Code) String() string {
+	if int(c) < len(codeNames) {
+		return codeNames[c]
+	}
+	return "Code(" + strconv.FormatUint(uint64(c), 10) + ")"
+}
+
+// Error 携带状态码的错误，服务端方法返回*Error时状态码及详情原样发送给客户端
+// 客户端可以通过errors.As获取
+type Error struct {
+	Code    Code   // 状态码
+	Message string // 错误信息
+	Details []byte // 错误详情，由业务自行定义格式
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// Is 状态码相同时errors.Is成立，如errors.Is(err, status.New(status.NotFound, ""))
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetails 返回带有详情的副本
+func (e *Error) WithDetails(details []byte) *Error {
+	out := *e
+	out.Details = details
+	return &out
+}
+
+// New 创建状态码错误
+func New(code Code, msg string) *Error {
+	return &Error{Code: code, Message: msg}
+}
+
+// Newf 创建状态码错误，错误信息格式同fmt.Sprintf
+func Newf(code Code, format string, a ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, a...))
+}
+
+// Convert 将err转换为状态码错误，err为nil时返回nil
+// context超时、取消分别转换为DeadlineExceeded、Canceled，其他普通error转换为Unknown
+func Convert(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return New(DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return New(Canceled, err.Error())
+	}
+	return New(Unknown, err.Error())
+}
+
+// CodeOf 返回err的状态码，err为nil时返回OK
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	return Convert(err).Code
+}